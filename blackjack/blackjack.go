@@ -0,0 +1,281 @@
+package blackjack
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the blackjack engine. Every action is a models.Play, so the store
+// can apply it to a table along with the cards it draws from the table's shoe
+// in a single transaction.
+
+const MAX_SEATS = 7
+
+// The number of decks in the shoe of a table unless another is given
+const SHOE_DECKS = 6
+
+// The most hands a seat can split into
+const MAX_HANDS = 4
+
+// The shoe is reshuffled before a round once less than a quarter is left
+const RESHUFFLE_FRACTION = 4
+
+const CARDS_PER_DECK = 52
+
+// The outcomes of a settled hand
+const OUTCOME_WIN = "win"
+const OUTCOME_BLACKJACK = "blackjack"
+const OUTCOME_PUSH = "push"
+const OUTCOME_LOSE = "lose"
+
+var ErrInvalidAction = errors.New("invalid action")
+var ErrShoeEmpty = errors.New("shoe is empty")
+var ErrInvalidBets = errors.New("invalid bets")
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidAction, reason)
+}
+
+// Total returns the best total of the cards, counting an ace as 11 unless
+// that would bust, and whether an ace is counted as 11.
+func Total(cards []models.Card) (int, bool) {
+	total, aces := 0, 0
+	for _, card := range cards {
+		switch {
+		case card.Value == models.Ace:
+			total++
+			aces++
+		case card.Value >= models.Jack:
+			total += 10
+		default:
+			total += int(card.Value)
+		}
+	}
+	if aces > 0 && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
+
+// IsBlackjack returns whether the hand is an ace and a ten-valued card dealt
+// as the first two cards.
+func IsBlackjack(hand models.TableHand) bool {
+	total, _ := Total(hand.Cards)
+	return len(hand.Cards) == 2 && total == 21 && !hand.Split
+}
+
+// NeedsShuffle returns whether so little of the shoe is left that it should
+// be reshuffled before the next round.
+func NeedsShuffle(shoe *models.Deck) bool {
+	return shoe.Remaining*RESHUFFLE_FRACTION < shoe.DeckCount*CARDS_PER_DECK
+}
+
+// dealCard draws the next card of the shoe into the hand.
+func dealCard(hand *models.TableHand, draw models.Draw) error {
+	cards, err := draw(1)
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return ErrShoeEmpty
+	}
+	card := cards[0]
+	card.ComputeCode()
+	hand.Cards = append(hand.Cards, card)
+	return nil
+}
+
+// Deal starts a round with a hand for every seat holding the seat's bet. Two
+// cards are dealt to every hand and the dealer, one at a time.
+func Deal(bets []int) models.Play {
+	return func(table *models.Table, draw models.Draw) error {
+		if table.Status == models.TABLE_PLAYING {
+			return invalid("the round is still being played")
+		}
+		if len(bets) != table.Seats {
+			return fmt.Errorf("%w: %d bets for %d seats", ErrInvalidBets, len(bets), table.Seats)
+		}
+		table.Hands = make([]models.TableHand, len(bets))
+		for i, bet := range bets {
+			table.Hands[i] = models.TableHand{Seat: i + 1, Bet: bet}
+		}
+		table.Dealer = models.TableHand{}
+		for round := 0; round < 2; round++ {
+			for i := range table.Hands {
+				if err := dealCard(&table.Hands[i], draw); err != nil {
+					return err
+				}
+			}
+			if err := dealCard(&table.Dealer, draw); err != nil {
+				return err
+			}
+		}
+		table.Status = models.TABLE_PLAYING
+		table.Turn = 0
+
+		// a dealer blackjack ends the round straight away
+		dealer_blackjack := IsBlackjack(table.Dealer)
+		for i := range table.Hands {
+			table.Hands[i].Finished = dealer_blackjack || IsBlackjack(table.Hands[i])
+		}
+		return advance(table, draw)
+	}
+}
+
+// currentHand returns the hand whose turn it is.
+func currentHand(table *models.Table) (*models.TableHand, error) {
+	if table.Status != models.TABLE_PLAYING {
+		return nil, invalid("no round is being played")
+	}
+	return &table.Hands[table.Turn], nil
+}
+
+// advance moves the turn on to the next hand still being played. Once every
+// hand is finished the dealer plays and the round is settled.
+func advance(table *models.Table, draw models.Draw) error {
+	for table.Turn < len(table.Hands) && table.Hands[table.Turn].Finished {
+		table.Turn++
+	}
+	if table.Turn < len(table.Hands) {
+		return nil
+	}
+	// the dealer only draws when a hand is left to beat
+	for _, hand := range table.Hands {
+		if total, _ := Total(hand.Cards); total <= 21 && !IsBlackjack(hand) && !IsBlackjack(table.Dealer) {
+			if err := playDealer(table, draw); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	settle(table)
+	table.Status = models.TABLE_FINISHED
+	return nil
+}
+
+// playDealer draws to the dealer until 17, drawing to a soft 17 when the
+// table hits soft 17s.
+func playDealer(table *models.Table, draw models.Draw) error {
+	for {
+		total, soft := Total(table.Dealer.Cards)
+		if total > 17 || (total == 17 && !(soft && table.HitSoft17)) {
+			return nil
+		}
+		if err := dealCard(&table.Dealer, draw); err != nil {
+			return err
+		}
+	}
+}
+
+// settle decides the outcome of every hand against the dealer's. A win pays
+// the bet and a blackjack pays 3 to 2.
+func settle(table *models.Table) {
+	dealer_total, _ := Total(table.Dealer.Cards)
+	dealer_blackjack := IsBlackjack(table.Dealer)
+	for i := range table.Hands {
+		hand := &table.Hands[i]
+		total, _ := Total(hand.Cards)
+		blackjack := IsBlackjack(*hand)
+		switch {
+		case total > 21:
+			hand.Outcome, hand.Payout = OUTCOME_LOSE, -float64(hand.Bet)
+		case blackjack && !dealer_blackjack:
+			hand.Outcome, hand.Payout = OUTCOME_BLACKJACK, float64(hand.Bet)*1.5
+		case blackjack && dealer_blackjack:
+			hand.Outcome, hand.Payout = OUTCOME_PUSH, 0
+		case dealer_blackjack:
+			hand.Outcome, hand.Payout = OUTCOME_LOSE, -float64(hand.Bet)
+		case dealer_total > 21 || total > dealer_total:
+			hand.Outcome, hand.Payout = OUTCOME_WIN, float64(hand.Bet)
+		case total == dealer_total:
+			hand.Outcome, hand.Payout = OUTCOME_PUSH, 0
+		default:
+			hand.Outcome, hand.Payout = OUTCOME_LOSE, -float64(hand.Bet)
+		}
+	}
+}
+
+// Hit deals another card to the hand being played, which is finished once it
+// reaches 21 or busts.
+func Hit(table *models.Table, draw models.Draw) error {
+	hand, err := currentHand(table)
+	if err != nil {
+		return err
+	}
+	if err := dealCard(hand, draw); err != nil {
+		return err
+	}
+	if total, _ := Total(hand.Cards); total >= 21 {
+		hand.Finished = true
+	}
+	return advance(table, draw)
+}
+
+// Stand finishes the hand being played.
+func Stand(table *models.Table, draw models.Draw) error {
+	hand, err := currentHand(table)
+	if err != nil {
+		return err
+	}
+	hand.Finished = true
+	return advance(table, draw)
+}
+
+// Double doubles the bet of a hand of two cards, which gets exactly one more
+// card.
+func Double(table *models.Table, draw models.Draw) error {
+	hand, err := currentHand(table)
+	if err != nil {
+		return err
+	}
+	if len(hand.Cards) != 2 {
+		return invalid("only a hand of two cards can double")
+	}
+	hand.Bet *= 2
+	hand.Doubled = true
+	if err := dealCard(hand, draw); err != nil {
+		return err
+	}
+	hand.Finished = true
+	return advance(table, draw)
+}
+
+// Split splits a pair into two hands with the same bet, each dealt a second
+// card. Split aces get one card each and can't be played further.
+func Split(table *models.Table, draw models.Draw) error {
+	hand, err := currentHand(table)
+	if err != nil {
+		return err
+	}
+	if len(hand.Cards) != 2 || hand.Cards[0].Value != hand.Cards[1].Value {
+		return invalid("only a pair can split")
+	}
+	seat_hands := 0
+	for _, other := range table.Hands {
+		if other.Seat == hand.Seat {
+			seat_hands++
+		}
+	}
+	if seat_hands >= MAX_HANDS {
+		return invalid(fmt.Sprintf("a seat can't split into more than %d hands", MAX_HANDS))
+	}
+
+	second := models.TableHand{Seat: hand.Seat, Bet: hand.Bet, Split: true, Cards: []models.Card{hand.Cards[1]}}
+	hand.Cards = hand.Cards[:1]
+	hand.Split = true
+	hands := append([]models.TableHand{}, table.Hands[:table.Turn+1]...)
+	hands = append(hands, second)
+	table.Hands = append(hands, table.Hands[table.Turn+1:]...)
+
+	aces := second.Cards[0].Value == models.Ace
+	for _, i := range []int{table.Turn, table.Turn + 1} {
+		if err := dealCard(&table.Hands[i], draw); err != nil {
+			return err
+		}
+		total, _ := Total(table.Hands[i].Cards)
+		table.Hands[i].Finished = aces || total == 21
+	}
+	return advance(table, draw)
+}
@@ -0,0 +1,196 @@
+package blackjack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/b055/cards/models"
+)
+
+// cards parses the card codes.
+func cards(t *testing.T, codes ...string) []models.Card {
+	var parsed []models.Card
+	for _, code := range codes {
+		suit, value, err := models.CodeToSuitValue(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, models.NewCard(*suit, *value))
+	}
+	return parsed
+}
+
+// shoe returns a draw dealing the cards in order.
+func shoe(t *testing.T, codes ...string) models.Draw {
+	remaining := cards(t, codes...)
+	return func(count int) ([]models.Card, error) {
+		if count > len(remaining) {
+			count = len(remaining)
+		}
+		drawn := remaining[:count]
+		remaining = remaining[count:]
+		return drawn, nil
+	}
+}
+
+// codes returns the codes of the cards in the hand.
+func codes(hand models.TableHand) []string {
+	var hand_codes []string
+	for _, card := range hand.Cards {
+		hand_codes = append(hand_codes, card.Code)
+	}
+	return hand_codes
+}
+
+func Test_Total(t *testing.T) {
+	for _, test := range []struct {
+		codes []string
+		total int
+		soft  bool
+	}{
+		{[]string{"AS", "KH"}, 21, true},
+		{[]string{"AS", "6H"}, 17, true},
+		{[]string{"AS", "6H", "10D"}, 17, false},
+		{[]string{"AS", "AH", "9D"}, 21, true},
+		{[]string{"KS", "QH", "2D"}, 22, false},
+		{[]string{"5S", "JD"}, 15, false},
+	} {
+		total, soft := Total(cards(t, test.codes...))
+		assert.Equal(t, test.total, total, test.codes)
+		assert.Equal(t, test.soft, soft, test.codes)
+	}
+}
+
+func Test_Deal(t *testing.T) {
+	table := &models.Table{Seats: 2, Status: models.TABLE_WAITING}
+	// seat 1, seat 2, dealer, then the second card of each
+	draw := shoe(t, "10S", "AS", "9D", "7H", "KH", "8C", "5C")
+	assert.NoError(t, Deal([]int{10, 20})(table, draw))
+	assert.Equal(t, models.TABLE_PLAYING, table.Status)
+	assert.Equal(t, []string{"10S", "7H"}, codes(table.Hands[0]))
+	assert.Equal(t, []string{"AS", "KH"}, codes(table.Hands[1]))
+	assert.Equal(t, []string{"9D", "8C"}, codes(table.Dealer))
+	// the blackjack is finished so the first seat plays
+	assert.True(t, table.Hands[1].Finished)
+	assert.Equal(t, 0, table.Turn)
+
+	// the first seat stands on 17 and pushes
+	assert.NoError(t, Stand(table, draw))
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	assert.Equal(t, OUTCOME_PUSH, table.Hands[0].Outcome)
+	assert.Equal(t, OUTCOME_BLACKJACK, table.Hands[1].Outcome)
+	assert.Equal(t, 30.0, table.Hands[1].Payout)
+
+	// a round can't be dealt for the wrong number of seats
+	assert.ErrorIs(t, Deal([]int{10})(table, draw), ErrInvalidBets)
+}
+
+func Test_Deal_DealerBlackjack(t *testing.T) {
+	table := &models.Table{Seats: 2, Status: models.TABLE_WAITING}
+	draw := shoe(t, "10S", "AS", "AD", "7H", "KH", "KC")
+	assert.NoError(t, Deal([]int{10, 10})(table, draw))
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	assert.Equal(t, OUTCOME_LOSE, table.Hands[0].Outcome)
+	assert.Equal(t, -10.0, table.Hands[0].Payout)
+	assert.Equal(t, OUTCOME_PUSH, table.Hands[1].Outcome)
+	assert.Len(t, table.Dealer.Cards, 2)
+}
+
+func Test_Hit(t *testing.T) {
+	table := &models.Table{Seats: 1}
+	draw := shoe(t, "10S", "9D", "5H", "7C", "KH", "10D")
+	assert.NoError(t, Deal([]int{10})(table, draw))
+
+	// 15 then 25 busts, and the dealer doesn't draw against a bust hand
+	assert.NoError(t, Hit(table, draw))
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	assert.Equal(t, OUTCOME_LOSE, table.Hands[0].Outcome)
+	assert.Len(t, table.Dealer.Cards, 2)
+
+	// nothing can be played once the round is over
+	assert.ErrorIs(t, Hit(table, draw), ErrInvalidAction)
+	assert.ErrorIs(t, Stand(table, draw), ErrInvalidAction)
+}
+
+func Test_Dealer_Soft17(t *testing.T) {
+	for _, hit_soft_17 := range []bool{false, true} {
+		table := &models.Table{Seats: 1, HitSoft17: hit_soft_17}
+		// the dealer has ace and six, a soft 17
+		draw := shoe(t, "10S", "AD", "9D", "6C", "3H")
+		assert.NoError(t, Deal([]int{10})(table, draw))
+		assert.NoError(t, Stand(table, draw))
+		total, _ := Total(table.Dealer.Cards)
+		if hit_soft_17 {
+			assert.Equal(t, 20, total)
+			assert.Equal(t, OUTCOME_LOSE, table.Hands[0].Outcome)
+		} else {
+			assert.Equal(t, 17, total)
+			assert.Equal(t, OUTCOME_WIN, table.Hands[0].Outcome)
+			assert.Equal(t, 10.0, table.Hands[0].Payout)
+		}
+	}
+}
+
+func Test_Double(t *testing.T) {
+	table := &models.Table{Seats: 1}
+	draw := shoe(t, "6S", "10D", "5D", "6C", "9H", "KH")
+	assert.NoError(t, Deal([]int{10})(table, draw))
+	assert.NoError(t, Double(table, draw))
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	assert.True(t, table.Hands[0].Doubled)
+	assert.Equal(t, 20, table.Hands[0].Bet)
+	// 20 against the dealer's bust 26
+	assert.Equal(t, OUTCOME_WIN, table.Hands[0].Outcome)
+	assert.Equal(t, 20.0, table.Hands[0].Payout)
+}
+
+func Test_Split(t *testing.T) {
+	table := &models.Table{Seats: 2}
+	draw := shoe(t, "8S", "10H", "10D", "8C", "9H", "7C",
+		"3H", "JS", "10C")
+	assert.NoError(t, Deal([]int{10, 5})(table, draw))
+	assert.NoError(t, Split(table, draw))
+	assert.Len(t, table.Hands, 3)
+	assert.Equal(t, []string{"8S", "3H"}, codes(table.Hands[0]))
+	assert.Equal(t, []string{"8C", "JS"}, codes(table.Hands[1]))
+	assert.Equal(t, 1, table.Hands[1].Seat)
+	assert.Equal(t, 10, table.Hands[1].Bet)
+	// only pairs split
+	assert.ErrorIs(t, Split(table, draw), ErrInvalidAction)
+
+	// 11 doubles, then 18 stands and the second seat stands on 19
+	assert.NoError(t, Double(table, draw))
+	assert.Equal(t, 1, table.Turn)
+	assert.NoError(t, Stand(table, draw))
+	assert.NoError(t, Stand(table, draw))
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	// the dealer stands on 17
+	assert.Equal(t, []string{OUTCOME_WIN, OUTCOME_WIN, OUTCOME_WIN},
+		[]string{table.Hands[0].Outcome, table.Hands[1].Outcome, table.Hands[2].Outcome})
+	assert.Equal(t, 20.0, table.Hands[0].Payout)
+}
+
+func Test_Split_Aces(t *testing.T) {
+	table := &models.Table{Seats: 1}
+	draw := shoe(t, "AS", "10D", "AD", "7C", "KH", "5C")
+	assert.NoError(t, Deal([]int{10})(table, draw))
+	assert.NoError(t, Split(table, draw))
+	// each ace gets one card and a split 21 isn't a blackjack
+	assert.Equal(t, models.TABLE_FINISHED, table.Status)
+	assert.Equal(t, OUTCOME_WIN, table.Hands[0].Outcome)
+	assert.Equal(t, 10.0, table.Hands[0].Payout)
+	assert.Equal(t, OUTCOME_LOSE, table.Hands[1].Outcome)
+}
+
+func Test_ShoeEmpty(t *testing.T) {
+	table := &models.Table{Seats: 1}
+	err := Deal([]int{10})(table, shoe(t, "AS", "KD"))
+	assert.True(t, errors.Is(err, ErrShoeEmpty))
+}
+
+func Test_NeedsShuffle(t *testing.T) {
+	assert.False(t, NeedsShuffle(&models.Deck{DeckCount: 6, Remaining: 78}))
+	assert.True(t, NeedsShuffle(&models.Deck{DeckCount: 6, Remaining: 77}))
+}
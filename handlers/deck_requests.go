@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the binding of request bodies that can be posted either as a form
+// or as JSON
+
+// createDeckForm holds the fields of a CreateDeck request as posted in a
+// form, which is how JSON requests are validated too.
+type createDeckForm struct {
+	Shuffled    string `form:"shuffled"`
+	Cards       string `form:"cards"`
+	Seed        string `form:"seed"`
+	ShuffleMode string `form:"shuffle_mode"`
+	DeckCount   string `form:"deck_count"`
+	DeckType    string `form:"deck_type"`
+}
+
+// createDeckJSON holds the fields of a CreateDeck request posted as JSON,
+// such as {"shuffled": true, "cards": ["AS", "KH"]}. Every field is decoded
+// on its own so that all the fields of the wrong type can be listed.
+type createDeckJSON struct {
+	Shuffled    json.RawMessage `json:"shuffled"`
+	Cards       json.RawMessage `json:"cards"`
+	Seed        json.RawMessage `json:"seed"`
+	ShuffleMode json.RawMessage `json:"shuffle_mode"`
+	DeckCount   json.RawMessage `json:"deck_count"`
+	DeckType    json.RawMessage `json:"deck_type"`
+}
+
+// createDeckRequest holds the validated fields of a CreateDeck request.
+type createDeckRequest struct {
+	cards        []models.Card
+	shuffled     bool
+	seed         *int64
+	shuffle_mode string
+	deck_count   int
+	deck_type    string
+}
+
+// decodeField decodes the JSON value of the field, which is left alone when
+// it is missing or null, and records an error when it has the wrong type.
+func decodeField(field string, raw json.RawMessage, value any, api_errs *[]*APIError) bool {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		*api_errs = append(*api_errs, invalidParameter(field, "invalid "+field+" "+string(raw)))
+		return false
+	}
+	return true
+}
+
+// toForm converts the JSON fields into their form equivalents.
+func (body createDeckJSON) toForm() (createDeckForm, []*APIError) {
+	var form createDeckForm
+	var api_errs []*APIError
+	var shuffled bool
+	if decodeField("shuffled", body.Shuffled, &shuffled, &api_errs) {
+		form.Shuffled = strconv.FormatBool(shuffled)
+	}
+	var cards []string
+	if decodeField("cards", body.Cards, &cards, &api_errs) {
+		// every code is checked on its own, since a code holding a comma
+		// would pass for several once they are joined
+		codes, err := validateCodeList(cards)
+		if err != nil {
+			api_errs = append(api_errs, err.(*APIError))
+		}
+		form.Cards = strings.Join(codes, ",")
+	}
+	var seed int64
+	if decodeField("seed", body.Seed, &seed, &api_errs) {
+		form.Seed = strconv.FormatInt(seed, 10)
+	}
+	decodeField("shuffle_mode", body.ShuffleMode, &form.ShuffleMode, &api_errs)
+	var deck_count int
+	if decodeField("deck_count", body.DeckCount, &deck_count, &api_errs) {
+		form.DeckCount = strconv.Itoa(deck_count)
+	}
+	decodeField("deck_type", body.DeckType, &form.DeckType, &api_errs)
+	return form, api_errs
+}
+
+// bindCreateDeck binds a CreateDeck request from a JSON body or, for any
+// other content type, from the form, and validates every field of it.
+func bindCreateDeck(c *gin.Context) (createDeckRequest, []*APIError) {
+	var form createDeckForm
+	var api_errs []*APIError
+	if c.ContentType() == binding.MIMEJSON {
+		var body createDeckJSON
+		if err := c.ShouldBindJSON(&body); err != nil {
+			return createDeckRequest{}, []*APIError{invalidBody("invalid JSON body: " + err.Error())}
+		}
+		form, api_errs = body.toForm()
+	} else if err := c.ShouldBindWith(&form, binding.Form); err != nil {
+		return createDeckRequest{}, []*APIError{invalidBody("invalid form: " + err.Error())}
+	}
+	request, validation_errs := validateCreateDeckForm(form)
+	return request, append(api_errs, validation_errs...)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Contains the errors the handlers respond with. Every error response has a
+// stable code for clients to act on, a message for people and, when the
+// error is about one field of the request, the name of that field.
+
+// A parameter or field of the request is invalid, or missing
+const INVALID_PARAMETER = "INVALID_PARAMETER"
+const MISSING_PARAMETER = "MISSING_PARAMETER"
+
+// A card code can't be parsed
+const INVALID_CARD_CODE = "INVALID_CARD_CODE"
+
+// The request body can't be parsed at all
+const INVALID_BODY = "INVALID_BODY"
+
+// What the request refers to doesn't exist
+const DECK_NOT_FOUND = "DECK_NOT_FOUND"
+const PILE_NOT_FOUND = "PILE_NOT_FOUND"
+const CARD_NOT_FOUND = "CARD_NOT_FOUND"
+const TABLE_NOT_FOUND = "TABLE_NOT_FOUND"
+const GAME_NOT_FOUND = "GAME_NOT_FOUND"
+const PLAYER_NOT_FOUND = "PLAYER_NOT_FOUND"
+
+// The deck is the shoe of a table or played by a game, or the pile the hand
+// of a game's player, whose cards are only played through the table or the
+// game
+const DECK_IN_PLAY = "DECK_IN_PLAY"
+const PILE_IN_PLAY = "PILE_IN_PLAY"
+
+// There aren't enough cards left to draw or deal
+const INSUFFICIENT_CARDS = "INSUFFICIENT_CARDS"
+
+// The request isn't allowed in the current state of the deck, table or game
+const INVALID_ACTION = "INVALID_ACTION"
+const NOT_YOUR_TURN = "NOT_YOUR_TURN"
+const NO_COMMITMENT = "NO_COMMITMENT"
+const DECK_NOT_FINISHED = "DECK_NOT_FINISHED"
+
+// The cards don't make a hand that can be evaluated
+const INVALID_HAND = "INVALID_HAND"
+
+// Something went wrong on our side
+const INTERNAL_ERROR = "INTERNAL_ERROR"
+
+// APIError is an error along with the status and the body it is answered
+// with.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+func invalidParameter(field string, message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: INVALID_PARAMETER, Message: message, Field: field}
+}
+
+func missingParameter(field string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: MISSING_PARAMETER, Message: field + " required", Field: field}
+}
+
+func invalidCardCode(field string, message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: INVALID_CARD_CODE, Message: message, Field: field}
+}
+
+func invalidBody(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: INVALID_BODY, Message: message}
+}
+
+func notFound(code string, field string, message string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: code, Message: message, Field: field}
+}
+
+func deckNotFound(deck_id string) *APIError {
+	return notFound(DECK_NOT_FOUND, "deck_id", "deck_id "+deck_id+" not found")
+}
+
+func deckInPlay(deck_id string, reason string) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: DECK_IN_PLAY, Message: "deck_id " + deck_id + " " + reason, Field: "deck_id"}
+}
+
+func pileInPlay(pile string) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: PILE_IN_PLAY, Message: "pile " + pile + " is the hand of a player, who draws through the game", Field: "pile"}
+}
+
+// conflict is an error for a request that can't be carried out in the
+// current state of the deck, table or game.
+func conflict(code string, message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: code, Message: message}
+}
+
+// internalError logs the unexpected error and returns the error answered in
+// its place, which only says what failed.
+func internalError(err error, message string) *APIError {
+	log.Error(err)
+	return &APIError{Status: http.StatusInternalServerError, Code: INTERNAL_ERROR, Message: message}
+}
+
+// writeError responds with the error. Errors other than APIErrors are
+// unexpected and answered as internal errors.
+func writeError(c *gin.Context, err error) {
+	var api_err *APIError
+	if !errors.As(err, &api_err) {
+		api_err = internalError(err, "Internal error")
+	}
+	c.JSON(api_err.Status, api_err)
+}
+
+// writeErrors responds with every error listed under errors. The code and
+// field are those of the first error and the messages are joined.
+func writeErrors(c *gin.Context, api_errs []*APIError) {
+	messages := make([]string, len(api_errs))
+	for i, api_err := range api_errs {
+		messages[i] = api_err.Message
+	}
+	c.JSON(api_errs[0].Status, gin.H{"code": api_errs[0].Code,
+		"message": strings.Join(messages, "; "),
+		"field":   api_errs[0].Field,
+		"errors":  api_errs})
+}
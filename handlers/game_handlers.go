@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
+)
+
+// Contains the handlers for the turn-based games
+
+// GameHandler serves the game endpoints. Players draw from the game's deck
+// through the deck handler.
+type GameHandler struct {
+	decks *DeckHandler
+	games store.GameStore
+}
+
+func NewGameHandler(deck_store store.DeckStore, game_store store.GameStore) *GameHandler {
+	return &GameHandler{decks: NewDeckHandler(deck_store), games: game_store}
+}
+
+func gameView(game *models.Game) gin.H {
+	return gin.H{"game_id": game.Id,
+		"deck_id":        game.DeckId,
+		"players":        game.Players,
+		"turn":           game.Turn,
+		"current_player": game.CurrentPlayer()}
+}
+
+// gameError writes the response for an error returned by the store for the
+// game.
+func gameError(c *gin.Context, err error, game_id string, action string) {
+	if errors.Is(err, store.ErrGameNotFound) {
+		writeError(c, notFound(GAME_NOT_FOUND, "game_id", "game_id "+game_id+" not found"))
+	} else if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, notFound(DECK_NOT_FOUND, "game_id", "the deck of game_id "+game_id+" no longer exists"))
+	} else if errors.Is(err, store.ErrPlayerNotFound) {
+		writeError(c, notFound(PLAYER_NOT_FOUND, "player", "player not found in game_id "+game_id))
+	} else if errors.Is(err, store.ErrNotYourTurn) {
+		writeError(c, &APIError{Status: http.StatusForbidden, Code: NOT_YOUR_TURN, Message: err.Error(), Field: "player"})
+	} else if errors.Is(err, store.ErrNoCardsLeft) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, "no cards left in the deck of game_id "+game_id))
+	} else {
+		writeError(c, internalError(err, "Failed to "+action+" game_id "+game_id))
+	}
+}
+
+func (h *GameHandler) CreateGame(c *gin.Context) {
+	log.Info("CreateGame Called")
+
+	deck_id, players, validation_err := validateCreateGame(c.PostForm("deck_id"), c.PostForm("players"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	if _, ok := h.decks.playableDeck(c, deck_id); !ok {
+		return
+	}
+
+	game := models.Game{Id: uuid.NewString(), DeckId: deck_id, Players: players}
+	if err := h.games.CreateGame(&game); errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if errors.Is(err, store.ErrDeckInPlay) {
+		writeError(c, deckInPlay(deck_id, "is already played by a table or game"))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to create game"))
+		return
+	}
+	writeCreated(c, game.Id, gameView(&game))
+}
+
+// GetGame shows the game along with the number of cards in every player's
+// hand.
+func (h *GameHandler) GetGame(c *gin.Context) {
+	log.Info("GetGame Called")
+
+	game_id, validation_err := validateGetGame(c.Param("game_id"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	game, err := h.games.GetGame(game_id)
+	if err != nil {
+		gameError(c, err, game_id, "get")
+		return
+	}
+	hands := gin.H{}
+	for _, player := range game.Players {
+		pile, _, err := h.decks.store.GetPile(game.DeckId, player)
+		if errors.Is(err, store.ErrPileNotFound) {
+			hands[player] = 0
+		} else if err != nil {
+			gameError(c, err, game_id, "get")
+			return
+		} else {
+			hands[player] = pile.Remaining
+		}
+	}
+	view := gameView(game)
+	view["hands"] = hands
+	c.JSON(http.StatusOK, view)
+}
+
+// DrawForPlayer draws cards from the game's deck into the hand of the player
+// whose turn it is. The store checks the turn along with the draw, so the
+// turn can't move on to someone else while they draw.
+func (h *GameHandler) DrawForPlayer(c *gin.Context) {
+	log.Info("DrawForPlayer Called")
+
+	game_id, player, count, validation_err := validateDrawForPlayer(c.Param("game_id"), c.Param("player"), c.Query("count"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("DrawForPlayer " + game_id + " " + player + " Called")
+
+	options := store.DrawOptions{Count: count, From: store.FROM_TOP}
+	deck, cards, err := h.games.DrawForPlayer(game_id, player, options)
+	if err != nil {
+		gameError(c, err, game_id, "draw for")
+		return
+	}
+	writeDrawn(c, deck, options, cards)
+}
+
+// EndTurn passes the turn of the player on to the next player.
+func (h *GameHandler) EndTurn(c *gin.Context) {
+	log.Info("EndTurn Called")
+
+	game_id, player, validation_err := validateGamePlayer(c.Param("game_id"), c.Param("player"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("EndTurn " + game_id + " " + player + " Called")
+
+	game, err := h.games.EndTurn(game_id, player)
+	if err != nil {
+		gameError(c, err, game_id, "end the turn in")
+		return
+	}
+	c.JSON(http.StatusOK, gameView(game))
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/base64"
 	"errors"
+	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -10,7 +12,9 @@ import (
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/b055/cards/blackjack"
 	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
 )
 
 // Contains validation logic for the API endpoints
@@ -18,26 +22,39 @@ import (
 
 func validateGetDeckById(deck_id string) (string, error) {
 	if deck_id == "" {
-		return "", errors.New("invalid deck_id")
+		return "", invalidParameter("deck_id", "invalid deck_id")
 	}
 	return deck_id, nil
 }
 
+// validateSort checks the ordering the cards of a deck are listed in, which
+// is nil to list them in the order they are in the deck.
+func validateSort(sort_param string) (*models.Ordering, error) {
+	if sort_param == "" {
+		return nil, nil
+	}
+	ordering, ok := models.GetOrdering(sort_param)
+	if !ok {
+		return nil, invalidParameter("sort", "invalid sort "+sort_param+", must be one of "+strings.Join(models.OrderingNames(), ", "))
+	}
+	return &ordering, nil
+}
+
 func validateGetAllDecks(page_token string) (*time.Time, error) {
 	if page_token != "" {
 		token_decoded, err := base64.StdEncoding.DecodeString(page_token)
 		if err != nil {
 			log.Error(err)
-			return nil, errors.New("invalid page token")
+			return nil, invalidParameter("page_token", "invalid page token")
 		}
 		value, err := strconv.ParseInt(string(token_decoded), 10, 64)
 		if err != nil {
 			log.Error(err)
-			return nil, errors.New("invalid page token")
+			return nil, invalidParameter("page_token", "invalid page token")
 		}
 		paginator := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
 		if value <= paginator.UnixNano() {
-			return nil, errors.New("invalid page token")
+			return nil, invalidParameter("page_token", "invalid page token")
 		}
 		paginator = time.Unix(0, value)
 		return &paginator, nil
@@ -47,61 +64,465 @@ func validateGetAllDecks(page_token string) (*time.Time, error) {
 
 func validateGetCardsInDeck(deck_id string, count_param string) (string, int, error) {
 	if deck_id == "" {
-		return "", 0, errors.New("invalid deck_id")
+		return "", 0, invalidParameter("deck_id", "invalid deck_id")
 	}
 
 	count := 1
 	if count_param != "" {
 		if count_value, err := strconv.Atoi(count_param); err != nil {
 			log.Error(err)
-			return "", 0, errors.New("invalid count " + count_param)
+			return "", 0, invalidParameter("count", "invalid count "+count_param)
 		} else {
 			if count_value < 1 {
-				return "", 0, errors.New("invalid count " + count_param)
+				return "", 0, invalidParameter("count", "invalid count "+count_param)
 			}
 			count = count_value
-			if count > NUMBER_OF_CARDS {
-				count = NUMBER_OF_CARDS
-			}
 		}
 		return deck_id, count, nil
 	} else {
-		return "", 0, errors.New("count required")
+		return "", 0, missingParameter("count")
+	}
+}
+
+// validateBool accepts true/false or 1/0 for the named parameter, which is
+// false when it is missing.
+func validateBool(name string, param string) (bool, error) {
+	var value = false
+	if param != "" {
+		log.Info(name + " parameter " + param)
+		// check if the parameter is valid
+		if param == "true" || param == "1" {
+			value = true
+		} else if (param != "false") && (param != "0") {
+			return value, invalidParameter(name, "Invalid parameter "+name+": "+param)
+		}
+	}
+	return value, nil
+}
+
+func validateShuffled(shuffled_param string) (bool, error) {
+	return validateBool("shuffled", shuffled_param)
+}
+
+func validateShuffleDeck(deck_id string, remaining_param string) (string, bool, error) {
+	if deck_id == "" {
+		return "", false, invalidParameter("deck_id", "invalid deck_id")
+	}
+	remaining_only, err := validateBool("remaining", remaining_param)
+	if err != nil {
+		return "", false, err
+	}
+	return deck_id, remaining_only, nil
+}
+
+func validateReturnDiscards(deck_id string, shuffled_param string) (string, bool, error) {
+	if deck_id == "" {
+		return "", false, invalidParameter("deck_id", "invalid deck_id")
+	}
+	shuffled, err := validateShuffled(shuffled_param)
+	if err != nil {
+		return "", false, err
+	}
+	return deck_id, shuffled, nil
+}
+
+// validateSeed parses the optional seed a deck is shuffled with. Without a
+// seed the deck is shuffled with crypto/rand.
+func validateSeed(seed_param string) (*int64, error) {
+	if seed_param == "" {
+		return nil, nil
+	}
+	seed, err := strconv.ParseInt(seed_param, 10, 64)
+	if err != nil {
+		log.Error(err)
+		return nil, invalidParameter("seed", "invalid seed "+seed_param)
+	}
+	return &seed, nil
+}
+
+// validateDeckCount parses the number of full decks shuffled together into a
+// shoe, which is 1 when it is missing.
+func validateDeckCount(deck_count_param string) (int, error) {
+	if deck_count_param == "" {
+		return 1, nil
+	}
+	deck_count, err := strconv.Atoi(deck_count_param)
+	if err != nil {
+		log.Error(err)
+		return 0, invalidParameter("deck_count", "invalid deck_count "+deck_count_param)
+	}
+	if deck_count < 1 || deck_count > MAX_DECK_COUNT {
+		return 0, invalidParameter("deck_count", "invalid deck_count "+deck_count_param+", must be between 1 and "+strconv.Itoa(MAX_DECK_COUNT))
+	}
+	return deck_count, nil
+}
+
+// validateDeckType checks the type of the decks to create, which is the
+// standard 52 card deck when it is missing. Custom decks don't have a type.
+func validateDeckType(deck_type_param string, cards_param string) (string, error) {
+	if cards_param != "" {
+		if deck_type_param != "" {
+			return "", invalidParameter("deck_type", "deck_type can't be used with cards")
+		}
+		return "", nil
 	}
+	if deck_type_param == "" {
+		return models.STANDARD_DECK, nil
+	}
+	if _, ok := models.GetDeckType(deck_type_param); !ok {
+		return "", invalidParameter("deck_type", "invalid deck_type "+deck_type_param+", must be one of "+strings.Join(models.DeckTypeNames(), ", "))
+	}
+	return deck_type_param, nil
+}
+
+// validateShuffleMode checks the mode a deck is shuffled with, which is
+// standard when it is missing. Secure decks can't be seeded.
+func validateShuffleMode(shuffle_mode_param string, seed *int64) (string, error) {
+	switch shuffle_mode_param {
+	case "", models.STANDARD_SHUFFLE:
+		return models.STANDARD_SHUFFLE, nil
+	case models.SECURE_SHUFFLE:
+		if seed != nil {
+			return "", invalidParameter("shuffle_mode", "seed can't be used with shuffle_mode "+models.SECURE_SHUFFLE)
+		}
+		return models.SECURE_SHUFFLE, nil
+	default:
+		return "", invalidParameter("shuffle_mode", "invalid shuffle_mode "+shuffle_mode_param)
+	}
+}
+
+// validateCodes splits the comma-separated card codes and checks every one of
+// them is valid. An empty parameter has no codes.
+func validateCodes(cards_param string) ([]string, error) {
+	if cards_param == "" {
+		return nil, nil
+	}
+	log.Info("cards " + cards_param)
+	return validateCodeList(strings.Split(cards_param, ","))
+}
+
+// validateCodeList checks every one of the card codes is valid, each on its
+// own, and returns them trimmed.
+func validateCodeList(card_params []string) ([]string, error) {
+	var codes []string
+	for _, card_param := range card_params {
+		card_param = strings.TrimSpace(card_param)
+		if len(card_param) == 0 {
+			return nil, invalidCardCode("cards", "Missing card")
+		}
+		if _, _, err := models.CodeToSuitValue(card_param); err != nil {
+			log.Error(err)
+			return nil, invalidCardCode("cards", "Invalid card: "+card_param)
+		}
+		codes = append(codes, card_param)
+	}
+	return codes, nil
+}
+
+// validateInsertCards checks the cards to insert into the deck and where they
+// go: the top, the bottom, random positions or an index counted from the top.
+// They go to the bottom unless another position is given.
+func validateInsertCards(deck_id string, cards_param string, position_param string) (string, []models.Card, store.InsertOptions, error) {
+	options := store.InsertOptions{At: store.AT_BOTTOM}
+	if deck_id == "" {
+		return "", nil, options, invalidParameter("deck_id", "invalid deck_id")
+	}
+	if cards_param == "" {
+		return "", nil, options, missingParameter("cards")
+	}
+	codes, err := validateCodes(cards_param)
+	if err != nil {
+		return "", nil, options, err
+	}
+	var cards []models.Card
+	for _, code := range codes {
+		suit, value, _ := models.CodeToSuitValue(code)
+		cards = append(cards, models.NewCard(*suit, *value))
+	}
+	switch position_param {
+	case "", store.AT_BOTTOM:
+	case store.AT_TOP, store.AT_RANDOM:
+		options.At = position_param
+	default:
+		index, err := strconv.Atoi(position_param)
+		if err != nil || index < 0 {
+			return "", nil, options, invalidParameter("position", "invalid position "+position_param)
+		}
+		options = store.InsertOptions{Index: index}
+	}
+	return deck_id, cards, options, nil
 }
 
 func validateCreateDeck(cards *[]models.Card, shuffled_param string, cards_param string) (bool, error) {
 	log.Info("CreateDeck called")
-	var shuffled = false
-	if shuffled_param != "" {
-		log.Info("shuffle parameter " + shuffled_param)
-		// check if shuffled parameter is valid
-		if shuffled_param == "true" || shuffled_param == "1" {
-			shuffled = true
-		} else if (shuffled_param != "false") && (shuffled_param != "0") {
-			return shuffled, errors.New("Invalid parameter shuffled: " + shuffled_param)
+	shuffled, err := validateShuffled(shuffled_param)
+	if err != nil {
+		return shuffled, err
+	}
+	codes, err := validateCodes(cards_param)
+	if err != nil {
+		return false, err
+	}
+	for _, code := range codes {
+		suit, value, _ := models.CodeToSuitValue(code)
+		card_id, uuid_err := uuid.NewUUID()
+		if uuid_err != nil {
+			panic(uuid_err)
+		}
+
+		card := models.NewCard(*suit, *value)
+		card.Id = card_id.String()
+		card.DeckId = "place-holder"
+		*cards = append(*cards, card)
+	}
+	return shuffled, nil
+}
+
+// validateCreateDeckForm validates every field of the form, listing the
+// errors of all the invalid fields.
+func validateCreateDeckForm(form createDeckForm) (createDeckRequest, []*APIError) {
+	var request createDeckRequest
+	var api_errs []*APIError
+	check := func(err error) {
+		var api_err *APIError
+		if errors.As(err, &api_err) {
+			api_errs = append(api_errs, api_err)
+		}
+	}
+	var err error
+	request.shuffled, err = validateShuffled(form.Shuffled)
+	check(err)
+	_, err = validateCreateDeck(&request.cards, "", form.Cards)
+	check(err)
+	request.seed, err = validateSeed(form.Seed)
+	check(err)
+	request.shuffle_mode, err = validateShuffleMode(form.ShuffleMode, request.seed)
+	check(err)
+	request.deck_count, err = validateDeckCount(form.DeckCount)
+	check(err)
+	request.deck_type, err = validateDeckType(form.DeckType, form.Cards)
+	check(err)
+	return request, api_errs
+}
+
+var pile_name_pattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func validatePileName(pile string) (string, error) {
+	if pile == models.DISCARD_PILE || !pile_name_pattern.MatchString(pile) {
+		return "", invalidParameter("pile", "invalid pile "+pile)
+	}
+	return pile, nil
+}
+
+func validateGetPile(deck_id string, pile string) (string, string, error) {
+	if deck_id == "" {
+		return "", "", invalidParameter("deck_id", "invalid deck_id")
+	}
+	pile, err := validatePileName(pile)
+	if err != nil {
+		return "", "", err
+	}
+	return deck_id, pile, nil
+}
+
+// validateAddToPile checks the draw of count cards from the top of the deck
+// onto the pile, which like any draw is partial unless the mode says
+// otherwise.
+func validateAddToPile(deck_id string, pile string, count_param string, mode_param string) (string, string, store.DrawOptions, error) {
+	deck_id, pile, err := validateGetPile(deck_id, pile)
+	if err != nil {
+		return "", "", store.DrawOptions{}, err
+	}
+	options, err := validateDrawOptions(deck_id, count_param, "", "", mode_param)
+	if err != nil {
+		return "", "", options, err
+	}
+	return deck_id, pile, options, nil
+}
+
+// validateDrawOptions checks which cards to draw. Either the codes of
+// specific cards are given, or a count along with where to draw them from,
+// which defaults to the top, and whether a draw of more cards than are left
+// is partial, the default, or strict.
+func validateDrawOptions(deck_id string, count_param string, from_param string, cards_param string, mode_param string) (store.DrawOptions, error) {
+	var options store.DrawOptions
+	var err error
+	if cards_param != "" {
+		if count_param != "" || from_param != "" || mode_param != "" {
+			return options, invalidParameter("cards", "cards can't be used with count, from and mode")
 		}
+		options.Codes, err = validateCodes(cards_param)
+		return options, err
+	}
+	switch from_param {
+	case "", store.FROM_TOP:
+		options.From = store.FROM_TOP
+	case store.FROM_BOTTOM, store.FROM_RANDOM:
+		options.From = from_param
+	default:
+		return options, invalidParameter("from", "invalid from "+from_param)
 	}
+	switch mode_param {
+	case "", store.DRAW_PARTIAL:
+		options.Mode = store.DRAW_PARTIAL
+	case store.DRAW_STRICT:
+		options.Mode = store.DRAW_STRICT
+	default:
+		return options, invalidParameter("mode", "invalid mode "+mode_param)
+	}
+	_, options.Count, err = validateGetCardsInDeck(deck_id, count_param)
+	return options, err
+}
+
+func validateDrawCardsInDeck(deck_id string, count_param string, from_param string, cards_param string, mode_param string) (string, store.DrawOptions, error) {
+	if deck_id == "" {
+		return "", store.DrawOptions{}, invalidParameter("deck_id", "invalid deck_id")
+	}
+	options, err := validateDrawOptions(deck_id, count_param, from_param, cards_param, mode_param)
+	if err != nil {
+		return "", options, err
+	}
+	return deck_id, options, nil
+}
+
+func validateDrawFromPile(deck_id string, pile string, count_param string, from_param string, cards_param string, mode_param string) (string, string, store.DrawOptions, error) {
+	deck_id, pile, err := validateGetPile(deck_id, pile)
+	if err != nil {
+		return "", "", store.DrawOptions{}, err
+	}
+	options, err := validateDrawOptions(deck_id, count_param, from_param, cards_param, mode_param)
+	if err != nil {
+		return "", "", options, err
+	}
+	return deck_id, pile, options, nil
+}
+
+// validateEvaluateHand checks the hand to evaluate is given either as the
+// codes of its cards or as a pile of a deck.
+func validateEvaluateHand(cards_param string, deck_id string, pile string) ([]string, string, string, error) {
 	if cards_param != "" {
-		log.Info("cards " + cards_param)
-		// check if cards parameters are valid
-		for _, card_param := range strings.Split(cards_param, ",") {
-			card_param = strings.TrimSpace(card_param)
-			if len(card_param) == 0 {
-				return false, errors.New("Missing card")
-			}
-			if suit, value, err := models.CodeToSuitValue(card_param); err != nil {
-				log.Error(err)
-				return false, errors.New("Invalid card: " + card_param)
-			} else {
-				card_id, uuid_err := uuid.NewUUID()
-				if uuid_err != nil {
-					panic(uuid_err)
-				}
-
-				*cards = append(*cards, models.Card{Id: card_id.String(), Suit: suit.String(), Value: value.String(), DeckId: "place-holder"})
-			}
+		if deck_id != "" || pile != "" {
+			return nil, "", "", invalidParameter("cards", "cards can't be used with deck_id and pile")
+		}
+		codes, err := validateCodes(cards_param)
+		if err != nil {
+			return nil, "", "", err
 		}
+		return codes, "", "", nil
 	}
-	return shuffled, nil
+	if deck_id == "" && pile == "" {
+		return nil, "", "", &APIError{Status: http.StatusBadRequest, Code: MISSING_PARAMETER, Message: "cards or deck_id and pile required", Field: "cards"}
+	}
+	deck_id, pile, err := validateGetPile(deck_id, pile)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return nil, deck_id, pile, nil
+}
+
+func validateGetTable(table_id string) (string, error) {
+	if table_id == "" {
+		return "", invalidParameter("table_id", "invalid table_id")
+	}
+	return table_id, nil
+}
+
+// validateCreateTable checks the number of seats at the table, the number of
+// decks in its shoe and whether the dealer hits soft 17s.
+func validateCreateTable(seats_param string, deck_count_param string, hit_soft_17_param string) (int, int, bool, error) {
+	seats := 1
+	if seats_param != "" {
+		var err error
+		if seats, err = strconv.Atoi(seats_param); err != nil || seats < 1 || seats > blackjack.MAX_SEATS {
+			return 0, 0, false, invalidParameter("seats", "invalid seats "+seats_param+", must be between 1 and "+strconv.Itoa(blackjack.MAX_SEATS))
+		}
+	}
+	deck_count := blackjack.SHOE_DECKS
+	if deck_count_param != "" {
+		var err error
+		if deck_count, err = validateDeckCount(deck_count_param); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	hit_soft_17, err := validateBool("hit_soft_17", hit_soft_17_param)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return seats, deck_count, hit_soft_17, nil
+}
+
+// validateDeal parses the comma-separated bets, one for every seat.
+func validateDeal(table_id string, bets_param string) (string, []int, error) {
+	table_id, err := validateGetTable(table_id)
+	if err != nil {
+		return "", nil, err
+	}
+	if bets_param == "" {
+		return "", nil, missingParameter("bets")
+	}
+	var bets []int
+	for _, bet_param := range strings.Split(bets_param, ",") {
+		bet, err := strconv.Atoi(strings.TrimSpace(bet_param))
+		if err != nil || bet < 1 {
+			return "", nil, invalidParameter("bets", "invalid bet "+bet_param)
+		}
+		bets = append(bets, bet)
+	}
+	return table_id, bets, nil
+}
+
+func validateGetGame(game_id string) (string, error) {
+	if game_id == "" {
+		return "", invalidParameter("game_id", "invalid game_id")
+	}
+	return game_id, nil
+}
+
+// validateCreateGame parses the comma-separated players, in the order they
+// take turns. Every player's hand is a pile named after them, so the names
+// must be valid pile names.
+func validateCreateGame(deck_id string, players_param string) (string, []string, error) {
+	if deck_id == "" {
+		return "", nil, invalidParameter("deck_id", "invalid deck_id")
+	}
+	if players_param == "" {
+		return "", nil, missingParameter("players")
+	}
+	var players []string
+	seated := map[string]bool{}
+	for _, player := range strings.Split(players_param, ",") {
+		player = strings.TrimSpace(player)
+		if _, err := validatePileName(player); err != nil {
+			return "", nil, invalidParameter("players", "invalid player "+player)
+		}
+		if seated[player] {
+			return "", nil, invalidParameter("players", "player "+player+" is seated twice")
+		}
+		seated[player] = true
+		players = append(players, player)
+	}
+	return deck_id, players, nil
+}
+
+func validateGamePlayer(game_id string, player string) (string, string, error) {
+	game_id, err := validateGetGame(game_id)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := validatePileName(player); err != nil {
+		return "", "", invalidParameter("player", "invalid player "+player)
+	}
+	return game_id, player, nil
+}
+
+func validateDrawForPlayer(game_id string, player string, count_param string) (string, string, int, error) {
+	game_id, player, err := validateGamePlayer(game_id, player)
+	if err != nil {
+		return "", "", 0, err
+	}
+	_, count, err := validateGetCardsInDeck(game_id, count_param)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return game_id, player, count, nil
 }
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
 )
 
 // Test_validateGetDeckByIdEmpty calls handlers.validateGetDeckById with an empty string,
@@ -64,9 +67,9 @@ func Test_validateGetCardsInDeck_InvalidCount(t *testing.T) {
 // should not return an error.
 func Test_validateGetCardsInDeck_ValidCount(t *testing.T) {
 	deck_id := "blah"
-	for _, count := range []string{"1", "10", "20"} {
+	for _, count := range []string{"1", "10", "20", "416"} {
 		validated_deck_id, validated_count, err := validateGetCardsInDeck(deck_id, count)
-		if err != nil {
+		if err != nil || strconv.Itoa(validated_count) != count {
 			t.Fatalf(`validateGetCardsInDeck(%q, %q) = %q, %q, %v, want %q, %q, %v`, deck_id, count, validated_deck_id, validated_count, err, deck_id, count, errors.New("invalid count "+count))
 		}
 	}
@@ -135,3 +138,318 @@ func Test_validateCreateDeck_ValidCardsParam(t *testing.T) {
 		}
 	}
 }
+
+// Test_validateReturnDiscards calls handlers.validateReturnDiscards with valid and invalid parameters.
+func Test_validateReturnDiscards(t *testing.T) {
+	for _, shuffled_param := range []string{"", "true", "0"} {
+		deck_id, _, err := validateReturnDiscards("blah", shuffled_param)
+		if deck_id != "blah" || err != nil {
+			t.Fatalf(`validateReturnDiscards("blah", %q) = %q, _, %v, want "blah", _, nil`, shuffled_param, deck_id, err)
+		}
+	}
+	for _, params := range [][]string{{"", "true"}, {"blah", "yes"}} {
+		_, _, err := validateReturnDiscards(params[0], params[1])
+		if err == nil {
+			t.Fatalf(`validateReturnDiscards(%q, %q) = _, _, nil, want error`, params[0], params[1])
+		}
+	}
+}
+
+// Test_validateShuffleDeck calls handlers.validateShuffleDeck with valid and invalid parameters.
+func Test_validateShuffleDeck(t *testing.T) {
+	for _, remaining_param := range []string{"", "1", "false"} {
+		deck_id, _, err := validateShuffleDeck("blah", remaining_param)
+		if deck_id != "blah" || err != nil {
+			t.Fatalf(`validateShuffleDeck("blah", %q) = %q, _, %v, want "blah", _, nil`, remaining_param, deck_id, err)
+		}
+	}
+	for _, params := range [][]string{{"", "true"}, {"blah", "all"}} {
+		_, _, err := validateShuffleDeck(params[0], params[1])
+		if err == nil {
+			t.Fatalf(`validateShuffleDeck(%q, %q) = _, _, nil, want error`, params[0], params[1])
+		}
+	}
+}
+
+// Test_validatePileName calls handlers.validatePileName with valid and invalid pile names.
+func Test_validatePileName(t *testing.T) {
+	for _, pile := range []string{"alice", "player_1", "Dealer-Hand"} {
+		if validated, err := validatePileName(pile); validated != pile || err != nil {
+			t.Fatalf(`validatePileName(%q) = %q, %v, want %q, nil`, pile, validated, err, pile)
+		}
+	}
+	for _, pile := range []string{"", "discard", "two words", "a/b", strings.Repeat("a", 65)} {
+		if _, err := validatePileName(pile); err == nil {
+			t.Fatalf(`validatePileName(%q) = _, nil, want error`, pile)
+		}
+	}
+}
+
+// Test_validateDrawFromPile calls handlers.validateDrawFromPile with valid and invalid parameters.
+func Test_validateDrawFromPile(t *testing.T) {
+	_, _, options, err := validateDrawFromPile("blah", "alice", "2", "", "", "")
+	if err != nil || options.Count != 2 || options.From != store.FROM_TOP {
+		t.Fatalf(`validateDrawFromPile("blah", "alice", "2", "", "", "") = _, _, %v, %v, want {2 top}, nil`, options, err)
+	}
+	_, _, options, err = validateDrawFromPile("blah", "alice", "", "", "AS, KH", "")
+	if err != nil || len(options.Codes) != 2 || options.Codes[1] != "KH" {
+		t.Fatalf(`validateDrawFromPile("blah", "alice", "", "", "AS, KH", "") = _, _, %v, %v, want [AS KH], nil`, options, err)
+	}
+	for _, params := range [][]string{{"2", "middle", ""}, {"", "top", ""}, {"1", "", "AS,ZZ"}} {
+		if _, _, _, err := validateDrawFromPile("blah", "alice", params[0], params[1], params[2], ""); err == nil {
+			t.Fatalf(`validateDrawFromPile("blah", "alice", %q, %q, %q) = _, _, _, nil, want error`, params[0], params[1], params[2])
+		}
+	}
+}
+
+// Test_validateSeed calls handlers.validateSeed with valid and invalid seeds.
+func Test_validateSeed(t *testing.T) {
+	if seed, err := validateSeed(""); seed != nil || err != nil {
+		t.Fatalf(`validateSeed("") = %v, %v, want nil, nil`, seed, err)
+	}
+	if seed, err := validateSeed("-42"); seed == nil || *seed != -42 || err != nil {
+		t.Fatalf(`validateSeed("-42") = %v, %v, want -42, nil`, seed, err)
+	}
+	for _, seed_param := range []string{"abc", "1.5", "99999999999999999999"} {
+		if _, err := validateSeed(seed_param); err == nil {
+			t.Fatalf(`validateSeed(%q) = _, nil, want error`, seed_param)
+		}
+	}
+}
+
+// Test_validateShuffleMode calls handlers.validateShuffleMode with valid and
+// invalid modes.
+func Test_validateShuffleMode(t *testing.T) {
+	seed := int64(42)
+	if mode, err := validateShuffleMode("", nil); mode != models.STANDARD_SHUFFLE || err != nil {
+		t.Fatalf(`validateShuffleMode("", nil) = %q, %v, want "standard", nil`, mode, err)
+	}
+	if mode, err := validateShuffleMode("standard", &seed); mode != models.STANDARD_SHUFFLE || err != nil {
+		t.Fatalf(`validateShuffleMode("standard", 42) = %q, %v, want "standard", nil`, mode, err)
+	}
+	if mode, err := validateShuffleMode("secure", nil); mode != models.SECURE_SHUFFLE || err != nil {
+		t.Fatalf(`validateShuffleMode("secure", nil) = %q, %v, want "secure", nil`, mode, err)
+	}
+	if _, err := validateShuffleMode("secure", &seed); err == nil {
+		t.Fatalf(`validateShuffleMode("secure", 42) = _, nil, want error`)
+	}
+	if _, err := validateShuffleMode("fast", nil); err == nil {
+		t.Fatalf(`validateShuffleMode("fast", nil) = _, nil, want error`)
+	}
+}
+
+// Test_validateDeckCount calls handlers.validateDeckCount with valid and
+// invalid deck counts.
+func Test_validateDeckCount(t *testing.T) {
+	if deck_count, err := validateDeckCount(""); deck_count != 1 || err != nil {
+		t.Fatalf(`validateDeckCount("") = %d, %v, want 1, nil`, deck_count, err)
+	}
+	if deck_count, err := validateDeckCount("8"); deck_count != 8 || err != nil {
+		t.Fatalf(`validateDeckCount("8") = %d, %v, want 8, nil`, deck_count, err)
+	}
+	for _, deck_count_param := range []string{"0", "-1", "9", "1.5", "six"} {
+		if _, err := validateDeckCount(deck_count_param); err == nil {
+			t.Fatalf(`validateDeckCount(%q) = _, nil, want error`, deck_count_param)
+		}
+	}
+}
+
+// Test_validateDeckType calls handlers.validateDeckType with valid and
+// invalid deck types.
+func Test_validateDeckType(t *testing.T) {
+	if deck_type, err := validateDeckType("", ""); deck_type != models.STANDARD_DECK || err != nil {
+		t.Fatalf(`validateDeckType("", "") = %q, %v, want "standard52", nil`, deck_type, err)
+	}
+	if deck_type, err := validateDeckType("euchre24", ""); deck_type != "euchre24" || err != nil {
+		t.Fatalf(`validateDeckType("euchre24", "") = %q, %v, want "euchre24", nil`, deck_type, err)
+	}
+	if deck_type, err := validateDeckType("", "AS,KH"); deck_type != "" || err != nil {
+		t.Fatalf(`validateDeckType("", "AS,KH") = %q, %v, want "", nil`, deck_type, err)
+	}
+	if _, err := validateDeckType("euchre24", "AS,KH"); err == nil {
+		t.Fatalf(`validateDeckType("euchre24", "AS,KH") = _, nil, want error`)
+	}
+	if _, err := validateDeckType("tarot78", ""); err == nil {
+		t.Fatalf(`validateDeckType("tarot78", "") = _, nil, want error`)
+	}
+}
+
+// Test_validateSort calls handlers.validateSort with valid and invalid
+// orderings.
+func Test_validateSort(t *testing.T) {
+	if ordering, err := validateSort(""); ordering != nil || err != nil {
+		t.Fatalf(`validateSort("") = %v, %v, want nil, nil`, ordering, err)
+	}
+	if ordering, err := validateSort("bridge"); ordering == nil || ordering.Name != "bridge" || err != nil {
+		t.Fatalf(`validateSort("bridge") = %v, %v, want bridge, nil`, ordering, err)
+	}
+	if _, err := validateSort("rank"); err == nil {
+		t.Fatalf(`validateSort("rank") = _, nil, want error`)
+	}
+}
+
+// Test_validateEvaluateHand calls handlers.validateEvaluateHand with valid and
+// invalid hands.
+func Test_validateEvaluateHand(t *testing.T) {
+	if codes, _, _, err := validateEvaluateHand("AS,KS,QS,JS,10S", "", ""); len(codes) != 5 || err != nil {
+		t.Fatalf(`validateEvaluateHand("AS,KS,QS,JS,10S", "", "") = %v, _, _, %v, want 5 codes, nil`, codes, err)
+	}
+	if _, deck_id, pile, err := validateEvaluateHand("", "deck", "alice"); deck_id != "deck" || pile != "alice" || err != nil {
+		t.Fatalf(`validateEvaluateHand("", "deck", "alice") = _, %q, %q, %v, want "deck", "alice", nil`, deck_id, pile, err)
+	}
+	for _, test := range [][3]string{{"", "", ""}, {"AS,KS", "deck", "alice"}, {"AS,ZZ", "", ""}, {"", "deck", ""}, {"", "deck", "discard"}} {
+		if _, _, _, err := validateEvaluateHand(test[0], test[1], test[2]); err == nil {
+			t.Fatalf(`validateEvaluateHand(%q, %q, %q) = _, _, _, nil, want error`, test[0], test[1], test[2])
+		}
+	}
+}
+
+// Test_validateCreateTable calls handlers.validateCreateTable with valid and
+// invalid tables.
+func Test_validateCreateTable(t *testing.T) {
+	if seats, deck_count, hit_soft_17, err := validateCreateTable("", "", ""); seats != 1 || deck_count != 6 || hit_soft_17 || err != nil {
+		t.Fatalf(`validateCreateTable("", "", "") = %d, %d, %t, %v, want 1, 6, false, nil`, seats, deck_count, hit_soft_17, err)
+	}
+	if seats, deck_count, hit_soft_17, err := validateCreateTable("3", "2", "true"); seats != 3 || deck_count != 2 || !hit_soft_17 || err != nil {
+		t.Fatalf(`validateCreateTable("3", "2", "true") = %d, %d, %t, %v, want 3, 2, true, nil`, seats, deck_count, hit_soft_17, err)
+	}
+	for _, test := range [][3]string{{"0", "", ""}, {"8", "", ""}, {"a", "", ""}, {"", "9", ""}, {"", "", "maybe"}} {
+		if _, _, _, err := validateCreateTable(test[0], test[1], test[2]); err == nil {
+			t.Fatalf(`validateCreateTable(%q, %q, %q) = _, _, _, nil, want error`, test[0], test[1], test[2])
+		}
+	}
+}
+
+// Test_validateDeal calls handlers.validateDeal with valid and invalid bets.
+func Test_validateDeal(t *testing.T) {
+	if _, bets, err := validateDeal("table", "10, 20"); len(bets) != 2 || bets[0] != 10 || bets[1] != 20 || err != nil {
+		t.Fatalf(`validateDeal("table", "10, 20") = _, %v, %v, want [10 20], nil`, bets, err)
+	}
+	for _, bets_param := range []string{"", "0", "-5", "10,,20", "ten"} {
+		if _, _, err := validateDeal("table", bets_param); err == nil {
+			t.Fatalf(`validateDeal("table", %q) = _, _, nil, want error`, bets_param)
+		}
+	}
+}
+
+// Test_validateCreateGame calls handlers.validateCreateGame with valid and
+// invalid players.
+func Test_validateCreateGame(t *testing.T) {
+	if _, players, err := validateCreateGame("deck", "alice, bob"); len(players) != 2 || players[0] != "alice" || players[1] != "bob" || err != nil {
+		t.Fatalf(`validateCreateGame("deck", "alice, bob") = _, %v, %v, want [alice bob], nil`, players, err)
+	}
+	for _, test := range [][2]string{{"", "alice"}, {"deck", ""}, {"deck", "alice,alice"}, {"deck", "alice,discard"}, {"deck", "alice,,bob"}} {
+		if _, _, err := validateCreateGame(test[0], test[1]); err == nil {
+			t.Fatalf(`validateCreateGame(%q, %q) = _, _, nil, want error`, test[0], test[1])
+		}
+	}
+}
+
+// Test_validateDrawForPlayer calls handlers.validateDrawForPlayer with valid
+// and invalid draws.
+func Test_validateDrawForPlayer(t *testing.T) {
+	if _, player, count, err := validateDrawForPlayer("game", "alice", "2"); player != "alice" || count != 2 || err != nil {
+		t.Fatalf(`validateDrawForPlayer("game", "alice", "2") = _, %q, %d, %v, want "alice", 2, nil`, player, count, err)
+	}
+	for _, test := range [][3]string{{"", "alice", "1"}, {"game", "", "1"}, {"game", "discard", "1"}, {"game", "alice", "0"}} {
+		if _, _, _, err := validateDrawForPlayer(test[0], test[1], test[2]); err == nil {
+			t.Fatalf(`validateDrawForPlayer(%q, %q, %q) = _, _, _, nil, want error`, test[0], test[1], test[2])
+		}
+	}
+}
+
+// Test_validateDrawCardsInDeck calls handlers.validateDrawCardsInDeck with
+// valid and invalid draws.
+func Test_validateDrawCardsInDeck(t *testing.T) {
+	if _, options, err := validateDrawCardsInDeck("blah", "3", "bottom", "", ""); err != nil || options.Count != 3 || options.From != store.FROM_BOTTOM {
+		t.Fatalf(`validateDrawCardsInDeck("blah", "3", "bottom", "", "") = _, %v, %v, want {3 bottom}, nil`, options, err)
+	}
+	if _, options, err := validateDrawCardsInDeck("blah", "", "", "AS,KH", ""); err != nil || len(options.Codes) != 2 {
+		t.Fatalf(`validateDrawCardsInDeck("blah", "", "", "AS,KH", "") = _, %v, %v, want [AS KH], nil`, options, err)
+	}
+	if _, options, err := validateDrawCardsInDeck("blah", "3", "", "", ""); err != nil || options.Mode != store.DRAW_PARTIAL {
+		t.Fatalf(`validateDrawCardsInDeck("blah", "3", "", "", "") = _, %v, %v, want partial, nil`, options, err)
+	}
+	if _, options, err := validateDrawCardsInDeck("blah", "3", "", "", "strict"); err != nil || options.Mode != store.DRAW_STRICT {
+		t.Fatalf(`validateDrawCardsInDeck("blah", "3", "", "", "strict") = _, %v, %v, want strict, nil`, options, err)
+	}
+	for _, params := range [][]string{{"", "1", "", "", ""}, {"blah", "1", "middle", "", ""}, {"blah", "", "random", "", ""}, {"blah", "", "", "AS,ZZ", ""}, {"blah", "1", "", "", "exact"},
+		{"blah", "2", "", "AS", ""}, {"blah", "", "random", "AS", ""}, {"blah", "", "", "AS", "strict"}} {
+		if _, _, err := validateDrawCardsInDeck(params[0], params[1], params[2], params[3], params[4]); err == nil {
+			t.Fatalf(`validateDrawCardsInDeck(%q, %q, %q, %q, %q) = _, _, nil, want error`, params[0], params[1], params[2], params[3], params[4])
+		}
+	}
+}
+
+// Test_validateInsertCards calls handlers.validateInsertCards with valid and
+// invalid positions.
+func Test_validateInsertCards(t *testing.T) {
+	_, cards, options, err := validateInsertCards("blah", "AS,X1", "")
+	if err != nil || len(cards) != 2 || cards[1].Code != "X1" || options.At != store.AT_BOTTOM {
+		t.Fatalf(`validateInsertCards("blah", "AS,X1", "") = _, %v, %v, %v, want [AS X1], bottom, nil`, cards, options, err)
+	}
+	if _, _, options, err := validateInsertCards("blah", "AS", "3"); err != nil || options.At != "" || options.Index != 3 {
+		t.Fatalf(`validateInsertCards("blah", "AS", "3") = _, _, %v, %v, want index 3, nil`, options, err)
+	}
+	for _, params := range [][]string{{"", "AS", ""}, {"blah", "", ""}, {"blah", "AS,ZZ", ""}, {"blah", "AS", "middle"}, {"blah", "AS", "-1"}} {
+		if _, _, _, err := validateInsertCards(params[0], params[1], params[2]); err == nil {
+			t.Fatalf(`validateInsertCards(%q, %q, %q) = _, _, _, nil, want error`, params[0], params[1], params[2])
+		}
+	}
+}
+
+// Test_validateCreateDeckForm calls handlers.validateCreateDeckForm with a
+// valid form and with a form whose fields are all invalid, which should all
+// be listed.
+func Test_validateCreateDeckForm(t *testing.T) {
+	request, field_errors := validateCreateDeckForm(createDeckForm{Shuffled: "true", Cards: "AS,KH", DeckCount: "2"})
+	if len(field_errors) != 0 || !request.shuffled || len(request.cards) != 2 || request.deck_count != 2 || request.deck_type != "" {
+		t.Fatalf(`validateCreateDeckForm(...) = %v, %v, want 2 shuffled cards twice, no errors`, request, field_errors)
+	}
+	_, field_errors = validateCreateDeckForm(createDeckForm{Shuffled: "maybe", Cards: "AS,ZZ", Seed: "x", ShuffleMode: "fast", DeckCount: "9", DeckType: "tarot"})
+	var fields []string
+	for _, field_error := range field_errors {
+		fields = append(fields, field_error.Field)
+	}
+	if strings.Join(fields, ",") != "shuffled,cards,seed,shuffle_mode,deck_count,deck_type" {
+		t.Fatalf(`validateCreateDeckForm(...) fields = %v, want every field`, fields)
+	}
+}
+
+// Test_createDeckJSON_toForm converts JSON fields into form fields, listing
+// every field of the wrong type.
+func Test_createDeckJSON_toForm(t *testing.T) {
+	var body createDeckJSON
+	json.Unmarshal([]byte(`{"shuffled": true, "cards": ["AS", "KH"], "seed": 42, "deck_count": 2, "deck_type": null}`), &body)
+	form, field_errors := body.toForm()
+	if len(field_errors) != 0 || form != (createDeckForm{Shuffled: "true", Cards: "AS,KH", Seed: "42", DeckCount: "2"}) {
+		t.Fatalf(`toForm() = %v, %v, want the form fields, no errors`, form, field_errors)
+	}
+	json.Unmarshal([]byte(`{"shuffled": "yes", "cards": "AS", "seed": 1.5, "shuffle_mode": 1, "deck_count": "2", "deck_type": []}`), &body)
+	if _, field_errors := body.toForm(); len(field_errors) != 6 {
+		t.Fatalf(`toForm() = _, %v, want 6 errors`, field_errors)
+	}
+}
+
+// Test_validators_APIError checks the validators return typed errors with
+// the code and the field they concern.
+func Test_validators_APIError(t *testing.T) {
+	tests := []struct {
+		err   error
+		code  string
+		field string
+	}{
+		{func() error { _, err := validateCodes("AS,ZZ"); return err }(), INVALID_CARD_CODE, "cards"},
+		{func() error { _, _, err := validateGetCardsInDeck("blah", ""); return err }(), MISSING_PARAMETER, "count"},
+		{func() error { _, _, err := validateGetCardsInDeck("blah", "-1"); return err }(), INVALID_PARAMETER, "count"},
+		{func() error { _, err := validateDeckCount("9"); return err }(), INVALID_PARAMETER, "deck_count"},
+		{func() error { _, err := validateShuffled("maybe"); return err }(), INVALID_PARAMETER, "shuffled"},
+		{func() error { _, _, err := validateDeal("table", "10,x"); return err }(), INVALID_PARAMETER, "bets"},
+	}
+	for i, test := range tests {
+		var api_err *APIError
+		if !errors.As(test.err, &api_err) || api_err.Code != test.code || api_err.Field != test.field {
+			t.Fatalf(`test %d: error = %#v, want code %s and field %s`, i, test.err, test.code, test.field)
+		}
+	}
+}
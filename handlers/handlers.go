@@ -2,42 +2,76 @@ package handlers
 
 import (
 	"encoding/base64"
-	"math/rand"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
-	"gorm.io/gorm"
 
 	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
 )
 
 // Contains the handlers for the different API endpoints
 
-const NUMBER_OF_CARDS = 52
 const PAGE_SIZE = 10
 
-func GetAllDecks(c *gin.Context) {
+// The most decks that can be shuffled together into a shoe
+const MAX_DECK_COUNT = 8
+
+// DeckHandler serves the deck endpoints from the given store.
+type DeckHandler struct {
+	store store.DeckStore
+}
+
+func NewDeckHandler(deck_store store.DeckStore) *DeckHandler {
+	return &DeckHandler{store: deck_store}
+}
+
+// openDeck returns the deck unless it doesn't exist or is the shoe of a
+// table, in which case it writes the error and returns false.
+func (h *DeckHandler) openDeck(c *gin.Context, deck_id string) (*models.Deck, bool) {
+	deck, err := h.store.GetDeck(deck_id)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return nil, false
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to get deck_id "+deck_id))
+		return nil, false
+	}
+	if deck.TableId != "" {
+		writeError(c, deckInPlay(deck_id, "is the shoe of a table"))
+		return nil, false
+	}
+	return deck, true
+}
+
+// playableDeck is openDeck for the endpoints that draw, shuffle or insert
+// cards, which the deck of a game only has done through the game.
+func (h *DeckHandler) playableDeck(c *gin.Context, deck_id string) (*models.Deck, bool) {
+	deck, ok := h.openDeck(c, deck_id)
+	if ok && deck.GameId != "" {
+		writeError(c, deckInPlay(deck_id, "is played by a game, whose players draw through the game"))
+		return nil, false
+	}
+	return deck, ok
+}
+
+func (h *DeckHandler) GetAllDecks(c *gin.Context) {
 	log.Info("GetAllDecks called")
 	paginator, validation_err := validateGetAllDecks(c.Query("page_token"))
 	if validation_err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": validation_err})
+		writeError(c, validation_err)
 		return
 	}
 
-	var decks []models.Deck
 	// using n + 1 pagination
-	var decks_result *gorm.DB
-	if paginator == nil {
-		decks_result = models.DB.Order("created_at desc").Limit(PAGE_SIZE + 1).Find(&decks)
-	} else {
-		decks_result = models.DB.Order("created_at desc").Limit(PAGE_SIZE+1).Where("created_at < ?", paginator).Find(&decks)
-	}
-	if decks_result.Error != nil {
-		log.Error(decks_result.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list decks"})
+	decks, err := h.store.ListDecks(paginator, PAGE_SIZE+1)
+	if err != nil {
+		writeError(c, internalError(err, "Failed to list decks"))
 		return
 	} else {
 		token := ""
@@ -55,51 +89,62 @@ func GetAllDecks(c *gin.Context) {
 		}
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "getAllDecks Called"})
 }
 
-func GetDeckById(c *gin.Context) {
+func (h *DeckHandler) GetDeckById(c *gin.Context) {
 	log.Info("GetDeckById Called")
 
 	deck_id, validation_err := validateGetDeckById(c.Param("deck_id"))
 	if validation_err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": validation_err})
+		writeError(c, validation_err)
+		return
+	}
+	ordering, validation_err := validateSort(c.Query("sort"))
+	if validation_err != nil {
+		writeError(c, validation_err)
 		return
 	}
 	log.Info("GetDeckById " + deck_id + " Called")
 
-	var deck models.Deck
-	if deck_result := models.DB.First(&deck, "id = ?", deck_id); deck_result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "deck_id " + deck_id + " not found"})
+	deck, ok := h.openDeck(c, deck_id)
+	if !ok {
 		return
-	} else {
-		var cards []models.Card
-		if cards_result := models.DB.Where("deck_id = ?", deck_id).Find(&cards); cards_result.Error != nil {
-			log.Error(cards_result.Error)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get cards for deck_id " + deck_id})
-			return
-		} else {
-			for i := 0; i < len(cards); i++ {
-				cards[i].ComputeCode()
-			}
-			c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
-				"shuffled":  deck.Shuffled,
-				"remaining": deck.Remaining,
-				"cards":     cards})
+	}
+	response := gin.H{"deck_id": deck_id,
+		"shuffled":     deck.Shuffled,
+		"remaining":    deck.Remaining,
+		"seed":         deck.Seed,
+		"deck_type":    deck.DeckType,
+		"deck_count":   deck.DeckCount,
+		"shuffle_mode": deck.ShuffleMode}
+	if deck.Commitment != "" {
+		response["commitment"] = deck.Commitment
+	}
+	// the cards of a secure deck stay hidden until they are all drawn, or
+	// its commitment wouldn't prove anything
+	if deck.Commitment == "" || deck.Remaining == 0 {
+		cards, err := h.store.GetCards(deck_id)
+		if err != nil {
+			writeError(c, internalError(err, "Failed to get cards for deck_id "+deck_id))
 			return
 		}
+		for i := 0; i < len(cards); i++ {
+			cards[i].ComputeCode()
+		}
+		if ordering != nil {
+			models.SortCards(cards, *ordering)
+		}
+		response["cards"] = cards
 	}
-
+	c.JSON(http.StatusOK, response)
 }
 
-func CreateDeck(c *gin.Context) {
+func (h *DeckHandler) CreateDeck(c *gin.Context) {
 	log.Info("CreateDeck Called")
 
-	var cards []models.Card
-	shuffled, validation_err := validateCreateDeck(&cards, c.PostForm("shuffled"), c.PostForm("cards"))
-	if validation_err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": validation_err})
+	request, api_errs := bindCreateDeck(c)
+	if len(api_errs) > 0 {
+		writeErrors(c, api_errs)
 		return
 	}
 
@@ -107,97 +152,283 @@ func CreateDeck(c *gin.Context) {
 	if uuid_err != nil {
 		panic(uuid_err)
 	}
-	card_count := NUMBER_OF_CARDS
-	if len(cards) > 0 {
-		card_count = len(cards)
+	deck := models.Deck{Id: deck_id.String(), Shuffled: request.shuffled, DeckType: request.deck_type, DeckCount: request.deck_count, Seed: request.seed, ShuffleMode: request.shuffle_mode}
+	cards := request.cards
+	if len(cards) == 0 {
+		// create whole decks of the deck type
+		definition, _ := models.GetDeckType(request.deck_type)
+		cards = definition.Cards()
 	}
-	deck := models.Deck{Id: deck_id.String(), Shuffled: shuffled, Remaining: card_count}
-	if result := models.DB.Create(&deck); result.Error != nil {
+	cards = newShoeCards(cards, request.deck_count)
+	for i := range cards {
+		cards[i].DeckId = deck.Id
+	}
+	deck.Remaining = len(cards)
+	if request.shuffled {
+		models.ShuffleCards(&deck, cards)
+	}
+	if request.shuffle_mode == models.SECURE_SHUFFLE {
+		if err := deck.CommitOrder(cards); err != nil {
+			writeError(c, internalError(err, "Failed to commit to the order of the deck"))
+			return
+		}
+	}
+	// create the deck along with the specified cards
+	if err := h.store.CreateDeck(&deck, cards); err != nil {
 		log.Errorf("Failed to create deck %v", deck)
-		log.Error(result.Error)
-		c.JSON(http.StatusBadRequest, gin.H{"message": result.Error})
+		writeError(c, internalError(err, "Failed to create deck"))
 		return
 	}
-	if len(cards) == 0 {
-		// create whole deck of cards
-		for i := 0; i <= 4; i++ {
-			for j := 0; j <= 13; j++ {
-				card_id, uuid_err := uuid.NewUUID()
-				if uuid_err != nil {
-					panic(uuid_err)
-				}
-				cards = append(cards, models.Card{Id: card_id.String(), Suit: models.Suit(i).String(), Value: models.Value(j).String(), DeckId: deck.Id})
+
+	writeCreated(c, deck.Id, deck)
+}
+
+// writeCreated responds with what was created along with its location, which
+// is the path it was created at followed by its id.
+func writeCreated(c *gin.Context, id string, created any) {
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+id)
+	c.JSON(http.StatusCreated, created)
+}
+
+// newShoeCards returns deck_count copies of the cards, each card with its own
+// id.
+func newShoeCards(cards []models.Card, deck_count int) []models.Card {
+	var shoe []models.Card
+	for n := 0; n < deck_count; n++ {
+		for _, card := range cards {
+			card_id, uuid_err := uuid.NewUUID()
+			if uuid_err != nil {
+				panic(uuid_err)
 			}
+			card.Id = card_id.String()
+			shoe = append(shoe, card)
 		}
 	}
-	if shuffled {
-		rand.Shuffle(len(cards), func(i, j int) {
-			cards[i], cards[j] = cards[j], cards[i]
-		})
+	return shoe
+}
+
+func (h *DeckHandler) DrawCardsInDeck(c *gin.Context) {
+	log.Info("GetCardsInDeck Called")
+
+	deck_id, options, err := validateDrawCardsInDeck(c.Param("deck_id"), c.Query("count"), c.Query("from"), c.Query("cards"), c.Query("mode"))
+	if err != nil {
+		log.Error("invalid deck_id or draw")
+		writeError(c, err)
+		return
+	}
+
+	log.Info("GetCardsInDeck " + deck_id + " Called")
+	if _, ok := h.playableDeck(c, deck_id); !ok {
+		return
+	}
+	h.drawCards(c, deck_id, models.DISCARD_PILE, options)
+}
+
+// drawCards draws the cards chosen by the options from the deck onto the pile
+// and responds with them, the cards left in the deck and how many of the
+// count couldn't be drawn.
+func (h *DeckHandler) drawCards(c *gin.Context, deck_id string, pile string, options store.DrawOptions) {
+	deck, cards, err := h.store.DrawCards(deck_id, pile, options)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if errors.Is(err, store.ErrCardNotFound) {
+		writeError(c, notFound(CARD_NOT_FOUND, "cards", err.Error()+" in deck_id "+deck_id))
+		return
+	} else if errors.Is(err, store.ErrNoCardsLeft) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, "no cards left in deck_id "+deck_id))
+		return
+	} else if errors.Is(err, store.ErrNotEnoughCards) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, err.Error()+" left in deck_id "+deck_id))
+		return
+	} else if errors.Is(err, store.ErrPileInPlay) {
+		writeError(c, pileInPlay(pile))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to draw cards from deck_id "+deck_id))
+		return
 	}
-	// create the specided amount of cards
+	writeDrawn(c, deck, options, cards)
+}
+
+// writeDrawn responds with the drawn cards, the cards left in the deck and
+// how many of the count couldn't be drawn.
+func writeDrawn(c *gin.Context, deck *models.Deck, options store.DrawOptions, cards []models.Card) {
 	for i := 0; i < len(cards); i++ {
-		cards[i].DeckId = deck.Id
-		if result := models.DB.Create(&cards[i]); result.Error != nil {
-			log.Errorf("Failed to create card %v", cards[i])
-			log.Error(result.Error)
-			c.JSON(http.StatusBadRequest, gin.H{"message": result.Error})
-			return
-		}
+		cards[i].ComputeCode()
 	}
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck.Id,
+		"remaining": deck.Remaining,
+		"shortfall": shortfall(options, len(cards)),
+		"cards":     cards})
+}
 
-	c.JSON(http.StatusOK, deck)
+// shortfall is how many fewer cards were drawn than the options asked for.
+func shortfall(options store.DrawOptions, drawn int) int {
+	if len(options.Codes) > 0 || options.Count <= drawn {
+		return 0
+	}
+	return options.Count - drawn
 }
 
-func DrawCardsInDeck(c *gin.Context) {
-	log.Info("GetCardsInDeck Called")
+func (h *DeckHandler) GetDiscardPile(c *gin.Context) {
+	log.Info("GetDiscardPile Called")
 
-	deck_id, count, err := validateGetCardsInDeck(c.Param("deck_id"), c.Query("count"))
+	deck_id, validation_err := validateGetDeckById(c.Param("deck_id"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("GetDiscardPile " + deck_id + " Called")
+
+	if _, ok := h.openDeck(c, deck_id); !ok {
+		return
+	}
+	cards, err := h.store.GetDiscards(deck_id)
 	if err != nil {
-		log.Error("invalid deck_id or count")
-		log.Error(err)
-		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		writeError(c, internalError(err, "Failed to get discards for deck_id "+deck_id))
 		return
 	}
+	for i := 0; i < len(cards); i++ {
+		cards[i].ComputeCode()
+	}
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
+		"remaining": len(cards),
+		"cards":     cards})
+}
 
-	log.Info("GetCardsInDeck " + deck_id + " Called")
+func (h *DeckHandler) ReturnDiscards(c *gin.Context) {
+	log.Info("ReturnDiscards Called")
 
-	var deck models.Deck
-	if deck_result := models.DB.First(&deck, "id = ?", deck_id); deck_result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "deck_id " + deck_id + " not found"})
+	deck_id, shuffled, validation_err := validateReturnDiscards(c.Param("deck_id"), c.PostForm("shuffled"))
+	if validation_err != nil {
+		writeError(c, validation_err)
 		return
-	} else {
-		var cards []models.Card
-		if cards_result := models.DB.Where("deck_id = ?", deck_id).Limit(count).Find(&cards); cards_result.Error != nil {
-			log.Error(cards_result.Error)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get cards for deck_id " + deck_id})
-			return
-		} else {
-			for i := 0; i < len(cards); i++ {
-				cards[i].ComputeCode()
-				if delete_result := models.DB.Delete(cards[i]); delete_result.Error != nil {
-					log.Errorf("Failed to delete card %v for deck_id %s", cards[i], deck_id)
-					log.Error(delete_result.Error)
-					c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get cards for deck_id " + deck_id})
-					return
-				}
-			}
-			remaining := deck.Remaining - len(cards)
-			if remaining < 0 {
-				remaining = 0
-			}
-			if update_result := models.DB.Model(deck).Update("Remaining", remaining); update_result.Error != nil {
-				log.Error("Failed to update remaining cards for deck_id " + deck_id)
-				log.Error(update_result.Error)
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get cards for deck_id " + deck_id})
-				return
-			}
+	}
+	log.Info("ReturnDiscards " + deck_id + " Called")
 
-			c.JSON(http.StatusOK, gin.H{
-				"cards": cards})
-			return
-		}
+	if _, ok := h.playableDeck(c, deck_id); !ok {
+		return
+	}
+	var shuffle models.Shuffle
+	if shuffled {
+		shuffle = models.ShuffleCards
+	}
+	deck, err := h.store.ReturnDiscards(deck_id, shuffle)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to return discards for deck_id "+deck_id))
+		return
+	}
+	c.JSON(http.StatusOK, deck)
+}
+
+func (h *DeckHandler) ShuffleDeck(c *gin.Context) {
+	log.Info("ShuffleDeck Called")
+
+	deck_id, remaining_only, validation_err := validateShuffleDeck(c.Param("deck_id"), c.PostForm("remaining"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("ShuffleDeck " + deck_id + " Called")
+
+	if _, ok := h.playableDeck(c, deck_id); !ok {
+		return
+	}
+	deck, err := h.store.ShuffleDeck(deck_id, !remaining_only, models.ShuffleCards)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to shuffle deck_id "+deck_id))
+		return
+	}
+	c.JSON(http.StatusOK, deck)
+}
 
+// DeleteDeck deletes the deck along with everything that plays with it.
+func (h *DeckHandler) DeleteDeck(c *gin.Context) {
+	log.Info("DeleteDeck Called")
+
+	deck_id, validation_err := validateGetDeckById(c.Param("deck_id"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("DeleteDeck " + deck_id + " Called")
+
+	if _, ok := h.openDeck(c, deck_id); !ok {
+		return
+	}
+	err := h.store.DeleteDeck(deck_id)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to delete deck_id "+deck_id))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InsertCards adds new cards to the deck at the top, the bottom, random
+// positions or a given index.
+func (h *DeckHandler) InsertCards(c *gin.Context) {
+	log.Info("InsertCards Called")
+
+	deck_id, cards, options, validation_err := validateInsertCards(c.Param("deck_id"), c.PostForm("cards"), c.PostForm("position"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("InsertCards " + deck_id + " Called")
+
+	if _, ok := h.playableDeck(c, deck_id); !ok {
+		return
+	}
+	deck, err := h.store.InsertCards(deck_id, cards, options)
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+		return
+	} else if errors.Is(err, store.ErrInvalidPosition) {
+		writeError(c, invalidParameter("position", err.Error()+" in deck_id "+deck_id))
+		return
+	} else if err != nil {
+		writeError(c, internalError(err, "Failed to insert cards into deck_id "+deck_id))
+		return
+	}
+	c.JSON(http.StatusOK, deck)
+}
+
+// RevealDeck reveals the salt and the initial order of a secure deck so that
+// they can be checked against its commitment once the game is over.
+func (h *DeckHandler) RevealDeck(c *gin.Context) {
+	log.Info("RevealDeck Called")
+
+	deck_id, validation_err := validateGetDeckById(c.Param("deck_id"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("RevealDeck " + deck_id + " Called")
+
+	deck, ok := h.openDeck(c, deck_id)
+	if !ok {
+		return
+	}
+	if deck.Commitment == "" {
+		writeError(c, &APIError{Status: http.StatusBadRequest, Code: NO_COMMITMENT, Message: "deck_id " + deck_id + " has no commitment to reveal", Field: "deck_id"})
+		return
+	}
+	if deck.Remaining > 0 {
+		writeError(c, conflict(DECK_NOT_FINISHED, "deck_id "+deck_id+" still has "+strconv.Itoa(deck.Remaining)+" cards to draw"))
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "getCardsInDeck " + deck_id + " Called"})
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
+		"commitment":    deck.Commitment,
+		"salt":          deck.Salt,
+		"initial_order": strings.Split(deck.InitialOrder, ",")})
 }
@@ -2,11 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -14,233 +14,900 @@ import (
 	"testing"
 )
 
-func init() {
-	models.ConnectDatabase()
+func newTestHandler() *DeckHandler {
+	return NewDeckHandler(store.NewMemoryStore())
 }
 
-func Test_CreateDeck_Shuffled(t *testing.T) {
+// serve calls the handler with a request of the method for the target, which
+// can carry a query, and the route params given as name and value pairs. A
+// body starting with { is sent as JSON and any other body as a form. It
+// returns the recorded response along with its decoded body.
+func serve(handler gin.HandlerFunc, method string, target string, body string, params ...string) (*httptest.ResponseRecorder, map[string]any) {
 	w := httptest.NewRecorder()
 	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	if strings.HasPrefix(body, "{") {
+		ctx.Request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		ctx.Params = append(ctx.Params, gin.Param{Key: params[i], Value: params[i+1]})
+	}
+	handler(ctx)
+	ctx.Writer.WriteHeaderNow()
+	var result map[string]any
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return w, result
+}
 
-	ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("shuffled=true"))
-	ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	CreateDeck(ctx)
-	assert.EqualValues(t, http.StatusOK, w.Code)
-	body, _ := io.ReadAll(w.Body)
+// cardCodes returns the codes of the cards in a decoded response.
+func cardCodes(cards any) []string {
+	var codes []string
+	list, _ := cards.([]any)
+	for _, card := range list {
+		codes = append(codes, card.(map[string]any)["code"].(string))
+	}
+	return codes
+}
 
-	var result map[string]any
-	json.Unmarshal(body, &result)
-	fmt.Println(result)
+func Test_CreateDeck_Shuffled(t *testing.T) {
+	handler := newTestHandler()
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
 	assert.NotNil(t, result["deck_id"])
 	assert.True(t, result["shuffled"].(bool))
 	assert.EqualValues(t, 52, result["remaining"])
 }
 
 func Test_CreateDeck_NotShuffled(t *testing.T) {
-	w := httptest.NewRecorder()
-	ctx, _ := gin.CreateTestContext(w)
-
-	ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("shuffled=false"))
-	ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	CreateDeck(ctx)
-	assert.EqualValues(t, http.StatusOK, w.Code)
-	body, _ := io.ReadAll(w.Body)
-
-	var result map[string]any
-	json.Unmarshal(body, &result)
+	handler := newTestHandler()
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=false")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
 	assert.NotNil(t, result["deck_id"])
 	assert.False(t, result["shuffled"].(bool))
 	assert.EqualValues(t, 52, result["remaining"])
 }
 
 func Test_CreateDeck_Cards(t *testing.T) {
+	handler := newTestHandler()
 	// create a deck and check for it
-	w := httptest.NewRecorder()
-	ctx, _ := gin.CreateTestContext(w)
-
-	ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("cards=AS,KD,AC,2C,KH"))
-	ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	CreateDeck(ctx)
-	assert.EqualValues(t, http.StatusOK, w.Code)
-	body, _ := io.ReadAll(w.Body)
-
-	var result map[string]any
-	json.Unmarshal(body, &result)
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KD,AC,2C,KH")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
 	assert.NotNil(t, result["deck_id"])
 	assert.False(t, result["shuffled"].(bool))
 	assert.EqualValues(t, 5, result["remaining"])
 }
 
 func Test_DrawCards(t *testing.T) {
-	var result map[string]any
-	{
-		// create the deck
-		w := httptest.NewRecorder()
-		ctx, _ := gin.CreateTestContext(w)
+	handler := newTestHandler()
+	// create the deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=false")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.NotNil(t, result["deck_id"])
+	assert.False(t, result["shuffled"].(bool))
+	assert.EqualValues(t, 52, result["remaining"])
+	deck_id := result["deck_id"].(string)
 
-		ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("shuffled=false"))
-		ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// draw some cards from the created deck
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=20", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
 
-		CreateDeck(ctx)
-		assert.EqualValues(t, http.StatusOK, w.Code)
-		body, _ := io.ReadAll(w.Body)
+	// check the number of cards remaining in the deck
+	w, get_deck_result := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, get_deck_result["deck_id"], result["deck_id"])
+	assert.EqualValues(t, 32, get_deck_result["remaining"])
+}
+
+func Test_GetDeckById(t *testing.T) {
+	handler := newTestHandler()
+	// create the deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=false")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.NotNil(t, result["deck_id"])
+	assert.False(t, result["shuffled"].(bool))
+	assert.EqualValues(t, 52, result["remaining"])
+
+	// check for the deck
+	w, get_deck_result := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", result["deck_id"].(string))
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, get_deck_result["deck_id"], result["deck_id"])
+}
 
-		json.Unmarshal(body, &result)
+func Test_GetAllDecks(t *testing.T) {
+	handler := newTestHandler()
+	// creates 13 decks
+	for i := 1; i <= 13; i++ {
+		w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=false")
+		assert.EqualValues(t, http.StatusCreated, w.Code)
 		assert.NotNil(t, result["deck_id"])
 		assert.False(t, result["shuffled"].(bool))
 		assert.EqualValues(t, 52, result["remaining"])
 	}
 
-	{
-		// draw some cards fromthe created deck
-		w := httptest.NewRecorder()
-
-		ctx, _ := gin.CreateTestContext(w)
-
-		ctx.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%q/", result["deck_id"]), nil)
-		ctx.Request.Header.Set("Content-Type", "application/json")
-		ctx.Request.URL, _ = url.Parse("?count=20")
-		ctx.Params = gin.Params{gin.Param{"deck_id", result["deck_id"].(string)}}
-		DrawCardsInDeck(ctx)
+	var page_count []int
+	target := "/"
+	for {
+		w, get_decks_result := serve(handler.GetAllDecks, http.MethodGet, target, "")
 		assert.EqualValues(t, http.StatusOK, w.Code)
+		assert.True(t, len(get_decks_result["decks"].([]any)) > 0)
+
+		page_count = append(page_count, len(get_decks_result["decks"].([]any)))
 
+		val, _ := get_decks_result["page_token"]
+		if val == nil {
+			break
+		}
+		target = "/?page_token=" + url.QueryEscape(val.(string))
 	}
+	// expect to go through at least 2 pages
+	assert.True(t, len(page_count) > 1)
+	// the last page shouldn't have the maximum anount of decks
+	assert.True(t, page_count[len(page_count)-1] < 10)
+}
 
-	{
-		// check the number of cards remaining in the deck
-		w := httptest.NewRecorder()
+func Test_DrawCards_Order(t *testing.T) {
+	handler := newTestHandler()
+	// create a shuffled deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true&cards=AS,KD,AC,2C,KH,3H,4D")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	deck_id := result["deck_id"].(string)
 
-		ctx, _ := gin.CreateTestContext(w)
+	// open the deck
+	w, get_deck_result := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	listed := cardCodes(get_deck_result["cards"])
+	assert.Len(t, listed, 7)
 
-		ctx.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%q/", result["deck_id"]), nil)
-		ctx.Request.Header.Set("Content-Type", "application/json")
-		ctx.Params = gin.Params{gin.Param{"deck_id", result["deck_id"].(string)}}
-		GetDeckById(ctx)
-		assert.EqualValues(t, http.StatusOK, w.Code)
-		var get_deck_result map[string]any
-		body, _ := io.ReadAll(w.Body)
-		json.Unmarshal(body, &get_deck_result)
+	// the cards are drawn in the order the deck was listed
+	w, draw_result := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=3", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, listed[:3], cardCodes(draw_result["cards"]))
+}
 
-		assert.EqualValues(t, get_deck_result["deck_id"], result["deck_id"])
-		assert.EqualValues(t, 32, get_deck_result["remaining"])
-	}
+func Test_DiscardPile(t *testing.T) {
+	handler := newTestHandler()
+	// create the deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KD,AC")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	deck_id := result["deck_id"].(string)
+
+	// draw two cards
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=2", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	// the drawn cards are on the discard pile, the last one on top
+	w, discard_result := serve(handler.GetDiscardPile, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, discard_result["remaining"])
+	assert.EqualValues(t, []string{"KD", "AS"}, cardCodes(discard_result["cards"]))
+	assert.NotNil(t, discard_result["cards"].([]any)[0].(map[string]any)["drawn_at"])
+
+	// return the discards to the deck
+	w, return_result := serve(handler.ReturnDiscards, http.MethodPost, "/", "shuffled=true", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 3, return_result["remaining"])
+	assert.True(t, return_result["shuffled"].(bool))
+
+	// the discard pile of an unknown deck isn't found
+	w, _ = serve(handler.GetDiscardPile, http.MethodGet, "/", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
 }
 
-func Test_GetDeckById(t *testing.T) {
-	var result map[string]any
-	{
-		// create the deck
-		w := httptest.NewRecorder()
-		ctx, _ := gin.CreateTestContext(w)
+func Test_ShuffleDeck(t *testing.T) {
+	handler := newTestHandler()
+	// create an unshuffled deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KD,AC,2C")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.False(t, result["shuffled"].(bool))
+	deck_id := result["deck_id"].(string)
 
-		ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("shuffled=false"))
-		ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// draw a card
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
 
-		CreateDeck(ctx)
-		assert.EqualValues(t, http.StatusOK, w.Code)
-		body, _ := io.ReadAll(w.Body)
+	// shuffle only the remaining cards
+	w, shuffle_result := serve(handler.ShuffleDeck, http.MethodPost, "/", "remaining=true", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.True(t, shuffle_result["shuffled"].(bool))
+	assert.EqualValues(t, 3, shuffle_result["remaining"])
 
-		json.Unmarshal(body, &result)
-		assert.NotNil(t, result["deck_id"])
-		assert.False(t, result["shuffled"].(bool))
-		assert.EqualValues(t, 52, result["remaining"])
-	}
+	// shuffle the discards back in
+	w, shuffle_result = serve(handler.ShuffleDeck, http.MethodPost, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 4, shuffle_result["remaining"])
+}
+
+func Test_Piles(t *testing.T) {
+	handler := newTestHandler()
+	// create the deck
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KD,AC,2C")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	deck_id := result["deck_id"].(string)
 
-	{
-		// check for the deck
-		w := httptest.NewRecorder()
+	// deal three cards to alice
+	w, add_result := serve(handler.AddToPile, http.MethodPost, "/", "count=3", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, add_result["remaining"])
+	assert.Len(t, add_result["cards"], 3)
+
+	// list alice's hand, the last card dealt on top
+	w, pile_result := serve(handler.GetPile, http.MethodGet, "/", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, "alice", pile_result["pile"])
+	cards := cardCodes(pile_result["cards"])
+	assert.Len(t, cards, 3)
+	assert.EqualValues(t, "AC", cards[0])
 
-		ctx, _ := gin.CreateTestContext(w)
+	// draw a specific card from alice's hand
+	w, draw_result := serve(handler.DrawFromPile, http.MethodGet, "/?cards=KD", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, []string{"KD"}, cardCodes(draw_result["cards"]))
+	assert.EqualValues(t, 2, draw_result["pile"].(map[string]any)["remaining"])
+
+	// a card alice doesn't hold isn't found
+	w, _ = serve(handler.DrawFromPile, http.MethodGet, "/?cards=2C", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+
+	// shuffle alice's hand
+	w, _ = serve(handler.ShufflePile, http.MethodPost, "/", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	// bob has no hand yet
+	w, _ = serve(handler.GetPile, http.MethodGet, "/", "", "deck_id", deck_id, "pile", "bob")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+}
 
-		ctx.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%q/", result["deck_id"]), nil)
-		ctx.Request.Header.Set("Content-Type", "application/json")
-		ctx.Params = gin.Params{gin.Param{"deck_id", result["deck_id"].(string)}}
-		GetDeckById(ctx)
+func Test_CreateDeck_Seeded(t *testing.T) {
+	handler := newTestHandler()
+	open_seeded := func() []string {
+		w, created := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true&seed=1234")
+		assert.EqualValues(t, http.StatusCreated, w.Code)
+		assert.EqualValues(t, 1234, created["seed"])
+		w, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", created["deck_id"].(string))
 		assert.EqualValues(t, http.StatusOK, w.Code)
-		var get_deck_result map[string]any
-		body, _ := io.ReadAll(w.Body)
-		json.Unmarshal(body, &get_deck_result)
+		return cardCodes(opened["cards"])
+	}
+
+	// the same seed always gives the same order
+	first := open_seeded()
+	second := open_seeded()
+	assert.NotEmpty(t, first)
+	assert.EqualValues(t, first, second)
+
+	// an invalid seed is rejected
+	w, _ := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true&seed=abc")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_CreateDeck_Secure(t *testing.T) {
+	handler := newTestHandler()
 
-		assert.EqualValues(t, get_deck_result["deck_id"], result["deck_id"])
+	w, created := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true&shuffle_mode=secure&cards=AS,KH,8C,2D,QS")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "secure", created["shuffle_mode"])
+	assert.Len(t, created["commitment"], 64)
+	deck_id := created["deck_id"].(string)
 
+	// the commitment is shown with the deck but not what it commits to, nor
+	// the cards in their order
+	w, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, created["commitment"], opened["commitment"])
+	assert.NotContains(t, opened, "salt")
+	assert.NotContains(t, opened, "cards")
+
+	// the deck can't be revealed while cards are left to draw
+	w, refused := serve(handler.RevealDeck, http.MethodPost, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, DECK_NOT_FINISHED, refused["code"])
+	assert.NotContains(t, refused, "salt")
+	_, drawn := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=4", "", "deck_id", deck_id)
+	order := cardCodes(drawn["cards"])
+	w, _ = serve(handler.RevealDeck, http.MethodPost, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	_, drawn = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1", "", "deck_id", deck_id)
+	order = append(order, cardCodes(drawn["cards"])...)
+
+	// after the game the revealed order checks out against the commitment
+	w, revealed := serve(handler.RevealDeck, http.MethodPost, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, created["commitment"], revealed["commitment"])
+	var codes []string
+	for _, code := range revealed["initial_order"].([]any) {
+		codes = append(codes, code.(string))
 	}
+	assert.Equal(t, order, codes)
+	assert.Equal(t, revealed["commitment"], models.ComputeCommitment(revealed["salt"].(string), strings.Join(codes, ",")))
+
+	// standard decks have nothing to reveal
+	w, standard := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "standard", standard["shuffle_mode"])
+	assert.NotContains(t, standard, "commitment")
+	w, _ = serve(handler.RevealDeck, http.MethodPost, "/", "", "deck_id", standard["deck_id"].(string))
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+
+	w, _ = serve(handler.RevealDeck, http.MethodPost, "/", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
 }
 
-func Test_GetAllDecks(t *testing.T) {
-	{
-		// creates 15 decks
-		for i := 1; i <= 13; i++ {
-			// create the deck
-			w := httptest.NewRecorder()
-			ctx, _ := gin.CreateTestContext(w)
-
-			ctx.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("shuffled=false"))
-			ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-			CreateDeck(ctx)
-			assert.EqualValues(t, http.StatusOK, w.Code)
-			body, _ := io.ReadAll(w.Body)
-			var result map[string]any
-			json.Unmarshal(body, &result)
-			assert.NotNil(t, result["deck_id"])
-			assert.False(t, result["shuffled"].(bool))
-			assert.EqualValues(t, 52, result["remaining"])
+func Test_CreateDeck_Shoe(t *testing.T) {
+	handler := newTestHandler()
+	count_cards := func(deck_id string) map[string]int {
+		w, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+		assert.EqualValues(t, http.StatusOK, w.Code)
+		counts := map[string]int{}
+		for _, code := range cardCodes(opened["cards"]) {
+			counts[code]++
 		}
+		return counts
+	}
 
+	// a six deck shoe has every card six times
+	w, shoe := serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=true&deck_count=6")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 312, shoe["remaining"])
+	assert.EqualValues(t, 6, shoe["deck_count"])
+	counts := count_cards(shoe["deck_id"].(string))
+	assert.Len(t, counts, 52)
+	for card, count := range counts {
+		assert.Equal(t, 6, count, card)
 	}
 
-	var first_get_decks_result map[string]any
-	var page_count []int
-	for {
-		// check for the deck
-		w := httptest.NewRecorder()
-		ctx, _ := gin.CreateTestContext(w)
+	// draws aren't capped at a single deck
+	w, drawn := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=100", "", "deck_id", shoe["deck_id"].(string))
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, drawn["cards"], 100)
+
+	// custom decks can repeat cards and are repeated for every deck
+	w, custom := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,AS,KH&deck_count=2")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 6, custom["remaining"])
+	assert.Equal(t, map[string]int{"AS": 4, "KH": 2}, count_cards(custom["deck_id"].(string)))
+}
 
-		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
-		if val, ok := first_get_decks_result["page_token"]; ok && val != nil {
-			ctx.Request.URL, _ = url.Parse("?page_token=" + val.(string))
+func Test_CreateDeck_DeckType(t *testing.T) {
+	handler := newTestHandler()
+
+	w, standard := serve(handler.CreateDeck, http.MethodPost, "/", "")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "standard52", standard["deck_type"])
+	assert.EqualValues(t, 52, standard["remaining"])
+
+	w, piquet := serve(handler.CreateDeck, http.MethodPost, "/", "deck_type=piquet32&deck_count=2")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "piquet32", piquet["deck_type"])
+	assert.EqualValues(t, 64, piquet["remaining"])
+
+	w, jokers := serve(handler.CreateDeck, http.MethodPost, "/", "deck_type=jokers54&shuffled=true")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 54, jokers["remaining"])
+
+	_, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", jokers["deck_id"].(string))
+	assert.Equal(t, "jokers54", opened["deck_type"])
+	var jokers_found []string
+	for _, code := range cardCodes(opened["cards"]) {
+		if code[0] == 'X' {
+			jokers_found = append(jokers_found, code)
 		}
-		ctx.Request.Header.Set("Content-Type", "application/json")
-		GetAllDecks(ctx)
-		assert.EqualValues(t, http.StatusOK, w.Code)
-		body, _ := io.ReadAll(w.Body)
-		json.Unmarshal(body, &first_get_decks_result)
+	}
+	assert.ElementsMatch(t, []string{"X1", "X2"}, jokers_found)
 
-		// assert.EqualValues(t, 10, len(first_get_decks_result["decks"].([]any)))
-		assert.True(t, len(first_get_decks_result["decks"].([]any)) > 0)
-		// assert.NotNil(t, first_get_decks_result["page_token"])
+	w, _ = serve(handler.CreateDeck, http.MethodPost, "/", "deck_type=tarot78")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, _ = serve(handler.CreateDeck, http.MethodPost, "/", "deck_type=euchre24&cards=AS,KH")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+}
 
-		page_count = append(page_count, len(first_get_decks_result["decks"].([]any)))
+func Test_CreateDeck_Jokers(t *testing.T) {
+	handler := newTestHandler()
 
-		if val, _ := first_get_decks_result["page_token"]; val == nil {
-			break
+	// a custom deck with jokers, twice over
+	w, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=X1,AS,x2&deck_count=2")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 6, deck["remaining"])
+	deck_id := deck["deck_id"].(string)
+
+	// the jokers keep their colour when they are dealt
+	w, _ = serve(handler.AddToPile, http.MethodPost, "/", "count=3", "deck_id", deck_id, "pile", "canasta")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	// and can be drawn by their code
+	w, drawn := serve(handler.DrawFromPile, http.MethodGet, "/?cards=X2", "", "deck_id", deck_id, "pile", "canasta")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	cards := drawn["cards"].([]any)
+	assert.Len(t, cards, 1)
+	card := cards[0].(map[string]any)
+	assert.Equal(t, "RED", card["suit"])
+	assert.Equal(t, "Joker", card["value"])
+	assert.Equal(t, "X2", card["code"])
+}
+
+func Test_CreateDeck_TenCodes(t *testing.T) {
+	handler := newTestHandler()
+	w, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=10H,0S,TD,tc")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+
+	// every spelling of ten comes back as 10
+	w, drawn := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=4", "", "deck_id", deck["deck_id"].(string))
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"10H", "10S", "10D", "10C"}, cardCodes(drawn["cards"]))
+}
+
+func Test_GetDeckById_Sorted(t *testing.T) {
+	handler := newTestHandler()
+	w, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=KH,AS,10H,2C,QS,QD")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	deck_id := deck["deck_id"].(string)
+
+	w, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"KH", "AS", "10H", "2C", "QS", "QD"}, cardCodes(opened["cards"]))
+	_, opened = serve(handler.GetDeckById, http.MethodGet, "/?sort=poker", "", "deck_id", deck_id)
+	assert.Equal(t, []string{"2C", "10H", "QS", "QD", "KH", "AS"}, cardCodes(opened["cards"]))
+	_, opened = serve(handler.GetDeckById, http.MethodGet, "/?sort=ace_low", "", "deck_id", deck_id)
+	assert.Equal(t, []string{"AS", "2C", "10H", "QS", "QD", "KH"}, cardCodes(opened["cards"]))
+	_, opened = serve(handler.GetDeckById, http.MethodGet, "/?sort=bridge", "", "deck_id", deck_id)
+	assert.Equal(t, []string{"2C", "10H", "QD", "QS", "KH", "AS"}, cardCodes(opened["cards"]))
+
+	// sorting doesn't change the order of the deck
+	_, opened = serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.Equal(t, []string{"KH", "AS", "10H", "2C", "QS", "QD"}, cardCodes(opened["cards"]))
+
+	w, _ = serve(handler.GetDeckById, http.MethodGet, "/?sort=rank", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_EvaluateHand(t *testing.T) {
+	handler := newTestHandler()
+
+	w, full_house := serve(handler.EvaluateHand, http.MethodGet, "/?cards=7S,7H,7D,2C,2D,KS", "")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, "full_house", full_house["category"])
+	assert.Len(t, full_house["cards"], 6)
+	_, flush := serve(handler.EvaluateHand, http.MethodGet, "/?cards=2H,7H,9H,JH,KH", "")
+	assert.Equal(t, "flush", flush["category"])
+	assert.Greater(t, full_house["rank"], flush["rank"])
+
+	w, _ = serve(handler.EvaluateHand, http.MethodGet, "/?cards=AS,KS,QS", "")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, _ = serve(handler.EvaluateHand, http.MethodGet, "/", "")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+
+	// a player's hand can be evaluated from their pile
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KS,QS,JS,10S,2D")
+	deck_id := deck["deck_id"].(string)
+	w, _ = serve(handler.AddToPile, http.MethodPost, "/", "count=5", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	w, royal := serve(handler.EvaluateHand, http.MethodGet, "/?deck_id="+deck_id+"&pile=alice", "")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, "royal_flush", royal["category"])
+
+	w, _ = serve(handler.EvaluateHand, http.MethodGet, "/?deck_id="+deck_id+"&pile=bob", "")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+}
+
+// Test_AddToPile_Modes checks adding to a pile is drawn like any other draw.
+func Test_AddToPile_Modes(t *testing.T) {
+	handler := newTestHandler()
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KH,8C")
+	deck_id := deck["deck_id"].(string)
+
+	w, result := serve(handler.AddToPile, http.MethodPost, "/", "count=4&mode=strict", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, INSUFFICIENT_CARDS, result["code"])
+	w, added := serve(handler.AddToPile, http.MethodPost, "/", "count=4", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"AS", "KH", "8C"}, cardCodes(added["cards"]))
+	assert.EqualValues(t, 0, added["remaining"])
+	assert.EqualValues(t, 1, added["shortfall"])
+	w, result = serve(handler.AddToPile, http.MethodPost, "/", "count=1", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, INSUFFICIENT_CARDS, result["code"])
+	w, _ = serve(handler.AddToPile, http.MethodPost, "/", "count=1&mode=exact", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_Table(t *testing.T) {
+	memory_store := store.NewMemoryStore()
+	handler := NewTableHandler(memory_store, memory_store)
+
+	w, table := serve(handler.CreateTable, http.MethodPost, "/", "seats=2&deck_count=1")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, models.TABLE_WAITING, table["status"])
+	table_id := table["table_id"].(string)
+	stored, err := memory_store.GetTable(table_id)
+	assert.Nil(t, err)
+	deck, err := memory_store.GetDeck(stored.DeckId)
+	assert.Nil(t, err)
+	assert.Equal(t, 52, deck.Remaining)
+
+	w, _ = serve(handler.CreateTable, http.MethodPost, "/", "seats=9")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, _ = serve(handler.Hit, http.MethodPost, "/", "", "table_id", table_id)
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	w, invalid := serve(handler.Deal, http.MethodPost, "/", "bets=10", "table_id", table_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, INVALID_PARAMETER, invalid["code"])
+	assert.Equal(t, "bets", invalid["field"])
+
+	w, table = serve(handler.Deal, http.MethodPost, "/", "bets=10,20", "table_id", table_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, table["hands"], 2)
+	deck, _ = memory_store.GetDeck(stored.DeckId)
+	assert.Equal(t, 52-6, deck.Remaining)
+	if table["status"] == models.TABLE_PLAYING {
+		// the dealer's hole card stays hidden until the dealer plays
+		dealer := table["dealer"].(map[string]any)
+		assert.Len(t, dealer["cards"], 1)
+		assert.EqualValues(t, 1, dealer["hidden"])
+		// a round can't be dealt while one is being played
+		w, _ = serve(handler.Deal, http.MethodPost, "/", "bets=10,20", "table_id", table_id)
+		assert.EqualValues(t, http.StatusConflict, w.Code)
+	}
+
+	// standing on every hand finishes the round
+	for table["status"] == models.TABLE_PLAYING {
+		w, table = serve(handler.Stand, http.MethodPost, "/", "", "table_id", table_id)
+		assert.EqualValues(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, models.TABLE_FINISHED, table["status"])
+	dealer := table["dealer"].(map[string]any)
+	assert.EqualValues(t, 0, dealer["hidden"])
+	for _, hand := range table["hands"].([]any) {
+		assert.NotEmpty(t, hand.(map[string]any)["outcome"])
+	}
+
+	w, table = serve(handler.GetTable, http.MethodGet, "/", "", "table_id", table_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, models.TABLE_FINISHED, table["status"])
+	w, _ = serve(handler.GetTable, http.MethodGet, "/", "", "table_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, _ = serve(handler.Stand, http.MethodPost, "/", "", "table_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+}
+
+// Test_Table_Rounds plays many rounds at a full table with a single deck,
+// which runs the shoe out in the middle of some of them.
+func Test_Table_Rounds(t *testing.T) {
+	memory_store := store.NewMemoryStore()
+	handler := NewTableHandler(memory_store, memory_store)
+
+	_, table := serve(handler.CreateTable, http.MethodPost, "/", "seats=7&deck_count=1")
+	table_id := table["table_id"].(string)
+	for round := 0; round < 50; round++ {
+		w, table := serve(handler.Deal, http.MethodPost, "/", "bets=10,10,10,10,10,10,10", "table_id", table_id)
+		if !assert.EqualValues(t, http.StatusOK, w.Code, "round %d", round) {
+			return
+		}
+		// every hand takes a third card and stands
+		for table["status"] == models.TABLE_PLAYING {
+			hand := table["hands"].([]any)[int(table["turn"].(float64))].(map[string]any)
+			play := handler.Stand
+			if len(hand["cards"].([]any)) < 3 {
+				play = handler.Hit
+			}
+			w, table = serve(play, http.MethodPost, "/", "", "table_id", table_id)
+			if !assert.EqualValues(t, http.StatusOK, w.Code, "round %d", round) {
+				return
+			}
 		}
 	}
-	fmt.Println(page_count)
-	// expect to go through at least 2 pages
-	assert.True(t, len(page_count) > 1)
-	// the last page shouldn't have the maximum anount of decks
-	assert.True(t, page_count[len(page_count)-1] < 10)
+	stored, _ := memory_store.GetTable(table_id)
+	shoe, _ := memory_store.GetDeck(stored.DeckId)
+	discards, _ := memory_store.GetDiscards(shoe.Id)
+	assert.Equal(t, 52, shoe.Remaining+len(discards))
+}
 
-	// {
-	// 	// check for the deck
-	// 	w := httptest.NewRecorder()
-	// 	ctx, _ := gin.CreateTestContext(w)
+// Test_Table_Shoe checks the shoe of a table can't be seen or played through
+// the deck endpoints, which would give away the dealer's hole card.
+func Test_Table_Shoe(t *testing.T) {
+	memory_store := store.NewMemoryStore()
+	handler := NewTableHandler(memory_store, memory_store)
+	decks := NewDeckHandler(memory_store)
+
+	_, table := serve(handler.CreateTable, http.MethodPost, "/", "seats=1&deck_count=1")
+	table_id := table["table_id"].(string)
+	assert.NotContains(t, table, "deck_id")
+	stored, _ := memory_store.GetTable(table_id)
+	shoe_id := stored.DeckId
+
+	_, table = serve(handler.Deal, http.MethodPost, "/", "bets=10", "table_id", table_id)
+	assert.NotContains(t, table, "deck_id")
+	for _, endpoint := range []gin.HandlerFunc{decks.GetDiscardPile, decks.GetDeckById, decks.DrawCardsInDeck,
+		decks.ShuffleDeck, decks.DeleteDeck, decks.RevealDeck} {
+		w, denied := serve(endpoint, http.MethodGet, "/?count=1", "", "deck_id", shoe_id)
+		assert.EqualValues(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, DECK_IN_PLAY, denied["code"])
+		assert.NotContains(t, denied, "cards")
+	}
+	w, _ := serve(decks.GetPile, http.MethodGet, "/", "", "deck_id", shoe_id, "pile", "dealer")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	_, created := serve(decks.CreateDeck, http.MethodPost, "/", "cards=AS")
+	w, listed := serve(decks.GetAllDecks, http.MethodGet, "/", "")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, listed["decks"], 1)
+	assert.Equal(t, created["deck_id"], listed["decks"].([]any)[0].(map[string]any)["deck_id"])
 
-	// 	ctx.Request = httptest.NewRequest(http.MethodGet, "/decks/", nil)
-	// 	ctx.Request.URL, _ = url.Parse("?page_token=" + first_get_decks_result["page_token"].(string))
-	// 	ctx.Request.Header.Set("Content-Type", "application/json")
-	// 	GetAllDecks(ctx)
-	// 	assert.EqualValues(t, http.StatusOK, w.Code)
-	// 	body, _ := io.ReadAll(w.Body)
-	// 	var second_get_decks_result map[string]any
-	// 	json.Unmarshal(body, &second_get_decks_result)
+	// the table plays on with its shoe untouched
+	deck, _ := memory_store.GetDeck(shoe_id)
+	assert.Equal(t, 52-4, deck.Remaining)
+	w, _ = serve(handler.GetTable, http.MethodGet, "/", "", "table_id", table_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+}
+
+func Test_Game(t *testing.T) {
+	memory_store := store.NewMemoryStore()
+	handler := NewGameHandler(memory_store, memory_store)
+
+	_, deck := serve(handler.decks.CreateDeck, http.MethodPost, "/", "cards=AS,KH,8C,2D")
+	deck_id := deck["deck_id"].(string)
+
+	w, _ := serve(handler.CreateGame, http.MethodPost, "/", "deck_id=missing&players=alice")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, game := serve(handler.CreateGame, http.MethodPost, "/", "deck_id="+deck_id+"&players=alice,bob")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "alice", game["current_player"])
+	game_id := game["game_id"].(string)
+
+	// only the current player can draw, into their own hand
+	w, _ = serve(handler.DrawForPlayer, http.MethodGet, "/?count=1", "", "game_id", game_id, "player", "bob")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	w, _ = serve(handler.DrawForPlayer, http.MethodGet, "/?count=1", "", "game_id", game_id, "player", "carol")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, drawn := serve(handler.DrawForPlayer, http.MethodGet, "/?count=2", "", "game_id", game_id, "player", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, drawn["cards"], 2)
+
+	w, _ = serve(handler.EndTurn, http.MethodPost, "/", "", "game_id", game_id, "player", "bob")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	w, unseated := serve(handler.EndTurn, http.MethodPost, "/", "", "game_id", game_id, "player", "carol")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, PLAYER_NOT_FOUND, unseated["code"])
+	w, game = serve(handler.EndTurn, http.MethodPost, "/", "", "game_id", game_id, "player", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bob", game["current_player"])
+	w, _ = serve(handler.DrawForPlayer, http.MethodGet, "/?count=1", "", "game_id", game_id, "player", "alice")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	w, _ = serve(handler.DrawForPlayer, http.MethodGet, "/?count=1", "", "game_id", game_id, "player", "bob")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+
+	w, game = serve(handler.GetGame, http.MethodGet, "/", "", "game_id", game_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]any{"alice": float64(2), "bob": float64(1)}, game["hands"])
+	w, _ = serve(handler.GetGame, http.MethodGet, "/", "", "game_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+
+	// the hands are piles of the deck, which can be listed but only played
+	// through the game
+	w, pile := serve(handler.decks.GetPile, http.MethodGet, "/", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, pile["cards"], 2)
+	w, denied := serve(handler.decks.DrawFromPile, http.MethodGet, "/?count=1", "", "deck_id", deck_id, "pile", "bob")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, PILE_IN_PLAY, denied["code"])
+	w, _ = serve(handler.decks.ShufflePile, http.MethodPost, "/", "", "deck_id", deck_id, "pile", "alice")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+
+	// nor can the deck be drawn, shuffled or added to but through the game
+	for _, endpoint := range []gin.HandlerFunc{handler.decks.DrawCardsInDeck, handler.decks.ShuffleDeck,
+		handler.decks.ReturnDiscards, handler.decks.InsertCards, handler.decks.AddToPile} {
+		w, denied = serve(endpoint, http.MethodPost, "/?count=1", "count=1&cards=QS", "deck_id", deck_id, "pile", "alice")
+		assert.EqualValues(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, DECK_IN_PLAY, denied["code"])
+	}
+	w, denied = serve(handler.CreateGame, http.MethodPost, "/", "deck_id="+deck_id+"&players=carol")
+	assert.EqualValues(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, DECK_IN_PLAY, denied["code"])
+	_, game = serve(handler.GetGame, http.MethodGet, "/", "", "game_id", game_id)
+	assert.Equal(t, map[string]any{"alice": float64(2), "bob": float64(1)}, game["hands"])
+	_, opened := serve(handler.decks.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, 1, opened["remaining"])
+}
+
+func Test_DrawCards_From(t *testing.T) {
+	handler := newTestHandler()
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KH,8C,2D")
+	deck_id := deck["deck_id"].(string)
+
+	w, drawn := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1&from=bottom", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"2D"}, cardCodes(drawn["cards"]))
+	w, drawn = serve(handler.DrawCardsInDeck, http.MethodGet, "/?cards=8C", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"8C"}, cardCodes(drawn["cards"]))
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?cards=8C", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1&from=middle", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, drawn = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=2", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"AS", "KH"}, cardCodes(drawn["cards"]))
+}
+
+func Test_InsertCards(t *testing.T) {
+	handler := newTestHandler()
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KH")
+	deck_id := deck["deck_id"].(string)
+
+	w, inserted := serve(handler.InsertCards, http.MethodPost, "/", "cards=QD,2C&position=1", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 4, inserted["remaining"])
+	w, _ = serve(handler.InsertCards, http.MethodPost, "/", "cards=ZZ", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, invalid := serve(handler.InsertCards, http.MethodPost, "/", "cards=3H&position=5", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "position", invalid["field"])
+	w, _ = serve(handler.InsertCards, http.MethodPost, "/", "cards=AS", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+
+	_, opened := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.Equal(t, []string{"AS", "QD", "2C", "KH"}, cardCodes(opened["cards"]))
+}
+
+func Test_DeleteDeck(t *testing.T) {
+	handler := newTestHandler()
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KH")
+	deck_id := deck["deck_id"].(string)
+
+	w, _ := serve(handler.DeleteDeck, http.MethodDelete, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusNoContent, w.Code)
+	w, _ = serve(handler.DeleteDeck, http.MethodDelete, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, _ = serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+}
+
+func Test_CreateDeck_JSON(t *testing.T) {
+	handler := newTestHandler()
+
+	w, deck := serve(handler.CreateDeck, http.MethodPost, "/", `{"shuffled": false, "cards": ["AS", "KH"]}`)
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 2, deck["remaining"])
+	assert.Equal(t, false, deck["shuffled"])
+	assert.Equal(t, nil, deck["deck_type"])
+	w, deck = serve(handler.CreateDeck, http.MethodPost, "/", `{"shuffled": true, "deck_type": "piquet32", "deck_count": 2}`)
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	assert.EqualValues(t, 64, deck["remaining"])
+	assert.Equal(t, true, deck["shuffled"])
+
+	// every bad field is listed
+	w, result := serve(handler.CreateDeck, http.MethodPost, "/", `{"shuffled": "yes", "cards": ["AS", "ZZ"], "deck_count": 9}`)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	var fields []any
+	for _, field_error := range result["errors"].([]any) {
+		fields = append(fields, field_error.(map[string]any)["field"])
+	}
+	assert.Equal(t, []any{"shuffled", "cards", "deck_count"}, fields)
+	assert.NotEmpty(t, result["message"])
+
+	// every code of the list is checked on its own
+	for _, body := range []string{`{"cards": ["AS,KH"]}`, `{"cards": ["AS", ""]}`, `{"cards": [" , "]}`} {
+		w, result = serve(handler.CreateDeck, http.MethodPost, "/", body)
+		assert.EqualValues(t, http.StatusBadRequest, w.Code, body)
+		assert.Equal(t, INVALID_CARD_CODE, result["code"], body)
+	}
 
-	// 	assert.EqualValues(t, 5, len(second_get_decks_result["decks"].([]any)))
-	// 	assert.Nil(t, second_get_decks_result["page_token"])
+	w, result = serve(handler.CreateDeck, http.MethodPost, "/", `{"shuffled": `)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, INVALID_BODY, result["code"])
+
+	// forms list every bad field as well
+	w, result = serve(handler.CreateDeck, http.MethodPost, "/", "shuffled=maybe&seed=x")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, result["errors"], 2)
+}
+
+func Test_ErrorEnvelope(t *testing.T) {
+	handler := newTestHandler()
+
+	w, result := serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, map[string]any{"code": DECK_NOT_FOUND, "message": "deck_id missing not found", "field": "deck_id"}, result)
+
+	w, result = serve(handler.DrawCardsInDeck, http.MethodGet, "/?cards=AS,ZZ", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, map[string]any{"code": INVALID_CARD_CODE, "message": "Invalid card: ZZ", "field": "cards"}, result)
+
+	w, result = serve(handler.DrawCardsInDeck, http.MethodGet, "/", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, map[string]any{"code": MISSING_PARAMETER, "message": "count required", "field": "count"}, result)
+
+	w, result = serve(handler.GetAllDecks, http.MethodGet, "/?page_token=abc", "")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, INVALID_PARAMETER, result["code"])
+	assert.Equal(t, "invalid page token", result["message"])
+}
+
+// failingStore is a store whose database has gone away.
+type failingStore struct {
+	store.DeckStore
+}
+
+var errDatabaseDown = errors.New("database is down")
+
+func (s failingStore) CreateDeck(deck *models.Deck, cards []models.Card) error {
+	return errDatabaseDown
+}
+
+func (s failingStore) GetDeck(deck_id string) (*models.Deck, error) {
+	return nil, errDatabaseDown
+}
+
+func Test_StatusCodes(t *testing.T) {
+	handler := newTestHandler()
+
+	// created
+	w, deck := serve(handler.CreateDeck, http.MethodPost, "/api/v1/decks", "cards=AS,KD")
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	deck_id := deck["deck_id"].(string)
+	assert.Equal(t, "/api/v1/decks/"+deck_id, w.Header().Get("Location"))
+
+	// validation errors
+	w, _ = serve(handler.CreateDeck, http.MethodPost, "/api/v1/decks", "deck_count=9")
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=abc", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+
+	// not found
+	w, _ = serve(handler.GetDeckById, http.MethodGet, "/", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1", "", "deck_id", "missing")
+	assert.EqualValues(t, http.StatusNotFound, w.Code)
+
+	// conflicts
+	w, _ = serve(handler.AddToPile, http.MethodPost, "/", "count=1", "deck_id", deck_id, "pile", "hand")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	w, _ = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=5", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	w, result := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, INSUFFICIENT_CARDS, result["code"])
+	w, _ = serve(handler.DrawFromPile, http.MethodGet, "/?count=1", "", "deck_id", deck_id, "pile", "hand")
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	w, result = serve(handler.DrawFromPile, http.MethodGet, "/?count=1", "", "deck_id", deck_id, "pile", "hand")
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, INSUFFICIENT_CARDS, result["code"])
+
+	// storage errors
+	failing := NewDeckHandler(failingStore{store.NewMemoryStore()})
+	w, result = serve(failing.CreateDeck, http.MethodPost, "/api/v1/decks", "shuffled=true")
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, INTERNAL_ERROR, result["code"])
+	w, _ = serve(failing.GetDeckById, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	w, _ = serve(failing.GetDiscardPile, http.MethodGet, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+	w, _ = serve(failing.RevealDeck, http.MethodPost, "/", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusInternalServerError, w.Code)
+}
+
+func Test_DrawCards_Mode(t *testing.T) {
+	handler := newTestHandler()
+	_, deck := serve(handler.CreateDeck, http.MethodPost, "/", "cards=AS,KH,8C")
+	deck_id := deck["deck_id"].(string)
+
+	// a strict draw of more cards than are left draws nothing
+	w, result := serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=5&mode=strict", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusConflict, w.Code)
+	assert.Equal(t, INSUFFICIENT_CARDS, result["code"])
+	w, result = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1&mode=strict", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, result["cards"], 1)
+	assert.EqualValues(t, 2, result["remaining"])
+	assert.EqualValues(t, 0, result["shortfall"])
+
+	// a partial draw, the default, takes what's left
+	w, result = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=5", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusOK, w.Code)
+	assert.Len(t, result["cards"], 2)
+	assert.EqualValues(t, 0, result["remaining"])
+	assert.EqualValues(t, 3, result["shortfall"])
 
-	// }
+	w, result = serve(handler.DrawCardsInDeck, http.MethodGet, "/?count=1&mode=exact", "", "deck_id", deck_id)
+	assert.EqualValues(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "mode", result["field"])
 }
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
+)
+
+// Contains the handlers for the named piles of a deck
+
+// pileError writes the response for an error returned by the store for a
+// pile of the deck.
+func pileError(c *gin.Context, err error, deck_id string, pile string, action string) {
+	if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, deckNotFound(deck_id))
+	} else if errors.Is(err, store.ErrPileNotFound) {
+		writeError(c, notFound(PILE_NOT_FOUND, "pile", "pile "+pile+" not found in deck_id "+deck_id))
+	} else if errors.Is(err, store.ErrCardNotFound) {
+		writeError(c, notFound(CARD_NOT_FOUND, "cards", err.Error()+" in pile "+pile))
+	} else if errors.Is(err, store.ErrNoCardsLeft) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, "no cards left in pile "+pile))
+	} else if errors.Is(err, store.ErrNotEnoughCards) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, err.Error()+" left in pile "+pile))
+	} else if errors.Is(err, store.ErrPileInPlay) {
+		writeError(c, pileInPlay(pile))
+	} else {
+		writeError(c, internalError(err, "Failed to "+action+" pile "+pile+" for deck_id "+deck_id))
+	}
+}
+
+// AddToPile draws cards from the top of the deck onto the pile, the same way
+// as any other draw.
+func (h *DeckHandler) AddToPile(c *gin.Context) {
+	log.Info("AddToPile Called")
+
+	deck_id, pile, options, validation_err := validateAddToPile(c.Param("deck_id"), c.Param("pile"), c.PostForm("count"), c.PostForm("mode"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("AddToPile " + deck_id + " " + pile + " Called")
+	if _, ok := h.playableDeck(c, deck_id); !ok {
+		return
+	}
+
+	h.drawCards(c, deck_id, pile, options)
+}
+
+func (h *DeckHandler) GetPile(c *gin.Context) {
+	log.Info("GetPile Called")
+
+	deck_id, pile, validation_err := validateGetPile(c.Param("deck_id"), c.Param("pile"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("GetPile " + deck_id + " " + pile + " Called")
+	if _, ok := h.openDeck(c, deck_id); !ok {
+		return
+	}
+
+	listed, cards, err := h.store.GetPile(deck_id, pile)
+	if err != nil {
+		pileError(c, err, deck_id, pile, "get")
+		return
+	}
+	for i := 0; i < len(cards); i++ {
+		cards[i].ComputeCode()
+	}
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
+		"pile":      listed.Name,
+		"remaining": listed.Remaining,
+		"cards":     cards})
+}
+
+func (h *DeckHandler) DrawFromPile(c *gin.Context) {
+	log.Info("DrawFromPile Called")
+
+	deck_id, pile, options, validation_err := validateDrawFromPile(c.Param("deck_id"), c.Param("pile"), c.Query("count"), c.Query("from"), c.Query("cards"), c.Query("mode"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("DrawFromPile " + deck_id + " " + pile + " Called")
+	if _, ok := h.openDeck(c, deck_id); !ok {
+		return
+	}
+
+	drawn_from, cards, err := h.store.DrawFromPile(deck_id, pile, options)
+	if err != nil {
+		pileError(c, err, deck_id, pile, "draw from")
+		return
+	}
+	for i := 0; i < len(cards); i++ {
+		cards[i].ComputeCode()
+	}
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
+		"pile":      drawn_from,
+		"remaining": drawn_from.Remaining,
+		"shortfall": shortfall(options, len(cards)),
+		"cards":     cards})
+}
+
+func (h *DeckHandler) ShufflePile(c *gin.Context) {
+	log.Info("ShufflePile Called")
+
+	deck_id, pile, validation_err := validateGetPile(c.Param("deck_id"), c.Param("pile"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("ShufflePile " + deck_id + " " + pile + " Called")
+	if _, ok := h.openDeck(c, deck_id); !ok {
+		return
+	}
+
+	shuffled, err := h.store.ShufflePile(deck_id, pile, models.ShuffleCards)
+	if err != nil {
+		pileError(c, err, deck_id, pile, "shuffle")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deck_id": deck_id,
+		"pile": shuffled})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/b055/cards/models"
+	"github.com/b055/cards/poker"
+)
+
+// Contains the handlers for evaluating poker hands
+
+func (h *DeckHandler) EvaluateHand(c *gin.Context) {
+	log.Info("EvaluateHand Called")
+
+	codes, deck_id, pile, validation_err := validateEvaluateHand(c.Query("cards"), c.Query("deck_id"), c.Query("pile"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+
+	var cards []models.Card
+	if len(codes) > 0 {
+		for _, code := range codes {
+			suit, value, _ := models.CodeToSuitValue(code)
+			cards = append(cards, models.NewCard(*suit, *value))
+		}
+	} else {
+		log.Info("EvaluateHand " + deck_id + " " + pile + " Called")
+		if _, ok := h.openDeck(c, deck_id); !ok {
+			return
+		}
+		var err error
+		if _, cards, err = h.store.GetPile(deck_id, pile); err != nil {
+			pileError(c, err, deck_id, pile, "evaluate")
+			return
+		}
+		for i := 0; i < len(cards); i++ {
+			cards[i].ComputeCode()
+		}
+	}
+
+	hand, err := poker.Evaluate(cards)
+	if err != nil {
+		writeError(c, &APIError{Status: http.StatusBadRequest, Code: INVALID_HAND, Message: err.Error(), Field: "cards"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"category": hand.Category.String(),
+		"rank":  hand.Rank,
+		"cards": cards})
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/b055/cards/blackjack"
+	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
+)
+
+// Contains the handlers for the blackjack tables
+
+// TableHandler serves the table endpoints. The shoe of every table is a deck
+// of the deck store.
+type TableHandler struct {
+	decks  store.DeckStore
+	tables store.TableStore
+}
+
+func NewTableHandler(deck_store store.DeckStore, table_store store.TableStore) *TableHandler {
+	return &TableHandler{decks: deck_store, tables: table_store}
+}
+
+// handView adds the total of the hand to it.
+func handView(hand models.TableHand) gin.H {
+	total, soft := blackjack.Total(hand.Cards)
+	return gin.H{"seat": hand.Seat,
+		"cards":    hand.Cards,
+		"total":    total,
+		"soft":     soft,
+		"bet":      hand.Bet,
+		"split":    hand.Split,
+		"doubled":  hand.Doubled,
+		"finished": hand.Finished,
+		"outcome":  hand.Outcome,
+		"payout":   hand.Payout}
+}
+
+// tableView shows the table, hiding the dealer's second card until the
+// dealer plays. The shoe isn't shown, since its cards are only played
+// through the table.
+func tableView(table *models.Table) gin.H {
+	hands := []gin.H{}
+	for _, hand := range table.Hands {
+		hands = append(hands, handView(hand))
+	}
+	dealer := models.TableHand{Cards: table.Dealer.Cards}
+	if table.Status == models.TABLE_PLAYING && len(dealer.Cards) > 1 {
+		dealer.Cards = dealer.Cards[:1]
+	}
+	dealer_total, _ := blackjack.Total(dealer.Cards)
+	return gin.H{"table_id": table.Id,
+		"seats":       table.Seats,
+		"hit_soft_17": table.HitSoft17,
+		"status":      table.Status,
+		"turn":        table.Turn,
+		"hands":       hands,
+		"dealer": gin.H{"cards": dealer.Cards,
+			"total":  dealer_total,
+			"hidden": len(table.Dealer.Cards) - len(dealer.Cards)}}
+}
+
+// tableError writes the response for an error returned by the store or the
+// blackjack engine for the table.
+func tableError(c *gin.Context, err error, table_id string, action string) {
+	if errors.Is(err, store.ErrTableNotFound) {
+		writeError(c, notFound(TABLE_NOT_FOUND, "table_id", "table_id "+table_id+" not found"))
+	} else if errors.Is(err, store.ErrDeckNotFound) {
+		writeError(c, notFound(DECK_NOT_FOUND, "table_id", "the shoe of table_id "+table_id+" no longer exists"))
+	} else if errors.Is(err, blackjack.ErrInvalidBets) {
+		writeError(c, invalidParameter("bets", err.Error()))
+	} else if errors.Is(err, blackjack.ErrInvalidAction) {
+		writeError(c, conflict(INVALID_ACTION, err.Error()))
+	} else if errors.Is(err, blackjack.ErrShoeEmpty) {
+		writeError(c, conflict(INSUFFICIENT_CARDS, err.Error()))
+	} else {
+		writeError(c, internalError(err, "Failed to "+action+" table_id "+table_id))
+	}
+}
+
+func (h *TableHandler) CreateTable(c *gin.Context) {
+	log.Info("CreateTable Called")
+
+	seats, deck_count, hit_soft_17, validation_err := validateCreateTable(c.PostForm("seats"), c.PostForm("deck_count"), c.PostForm("hit_soft_17"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+
+	// the shoe is a shuffled deck of its own, which only the table plays
+	table_id := uuid.NewString()
+	shoe := models.Deck{Id: uuid.NewString(), TableId: table_id, Shuffled: true, DeckType: models.STANDARD_DECK, DeckCount: deck_count, ShuffleMode: models.STANDARD_SHUFFLE}
+	definition, _ := models.GetDeckType(models.STANDARD_DECK)
+	cards := newShoeCards(definition.Cards(), deck_count)
+	for i := range cards {
+		cards[i].DeckId = shoe.Id
+	}
+	shoe.Remaining = len(cards)
+	models.ShuffleCards(&shoe, cards)
+	if err := h.decks.CreateDeck(&shoe, cards); err != nil {
+		writeError(c, internalError(err, "Failed to create the shoe"))
+		return
+	}
+
+	table := models.Table{Id: table_id, DeckId: shoe.Id, Seats: seats, HitSoft17: hit_soft_17, Status: models.TABLE_WAITING}
+	if err := h.tables.CreateTable(&table); err != nil {
+		writeError(c, internalError(err, "Failed to create table"))
+		return
+	}
+	writeCreated(c, table.Id, tableView(&table))
+}
+
+func (h *TableHandler) GetTable(c *gin.Context) {
+	log.Info("GetTable Called")
+
+	table_id, validation_err := validateGetTable(c.Param("table_id"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	table, err := h.tables.GetTable(table_id)
+	if err != nil {
+		tableError(c, err, table_id, "get")
+		return
+	}
+	c.JSON(http.StatusOK, tableView(table))
+}
+
+// Deal starts a new round at the table, reshuffling the shoe first when
+// little of it is left.
+func (h *TableHandler) Deal(c *gin.Context) {
+	log.Info("Deal Called")
+
+	table_id, bets, validation_err := validateDeal(c.Param("table_id"), c.PostForm("bets"))
+	if validation_err != nil {
+		writeError(c, validation_err)
+		return
+	}
+	log.Info("Deal " + table_id + " Called")
+
+	table, err := h.tables.GetTable(table_id)
+	if err != nil {
+		tableError(c, err, table_id, "deal at")
+		return
+	}
+	shoe, err := h.decks.GetDeck(table.DeckId)
+	if err != nil {
+		tableError(c, err, table_id, "deal at")
+		return
+	}
+	if table.Status != models.TABLE_PLAYING && blackjack.NeedsShuffle(shoe) {
+		if _, err := h.decks.ShuffleDeck(shoe.Id, true, models.ShuffleCards); err != nil {
+			tableError(c, err, table_id, "reshuffle the shoe of")
+			return
+		}
+	}
+	h.play(c, table_id, "deal at", blackjack.Deal(bets))
+}
+
+// play applies the play to the table and writes the table back.
+func (h *TableHandler) play(c *gin.Context, table_id string, action string, play models.Play) {
+	table, err := h.tables.PlayTable(table_id, play)
+	if err != nil {
+		tableError(c, err, table_id, action)
+		return
+	}
+	c.JSON(http.StatusOK, tableView(table))
+}
+
+// playAction returns the handler for an action of the player whose turn it
+// is.
+func (h *TableHandler) playAction(action string, play models.Play) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log.Info(action + " Called")
+
+		table_id, validation_err := validateGetTable(c.Param("table_id"))
+		if validation_err != nil {
+			writeError(c, validation_err)
+			return
+		}
+		log.Info(action + " " + table_id + " Called")
+		h.play(c, table_id, action, play)
+	}
+}
+
+func (h *TableHandler) Hit(c *gin.Context) {
+	h.playAction("Hit", blackjack.Hit)(c)
+}
+
+func (h *TableHandler) Stand(c *gin.Context) {
+	h.playAction("Stand", blackjack.Stand)(c)
+}
+
+func (h *TableHandler) Double(c *gin.Context) {
+	h.playAction("Double", blackjack.Double)(c)
+}
+
+func (h *TableHandler) Split(c *gin.Context) {
+	h.playAction("Split", blackjack.Split)(c)
+}
@@ -1,26 +1,103 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
 	"github.com/b055/cards/models"
+	"github.com/b055/cards/store"
 
 	"github.com/b055/cards/handlers"
 	"github.com/gin-gonic/gin"
 )
 
+// How long requests in flight get to finish on shutdown
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
 func main() {
-	models.ConnectDatabase()
+	db, err := models.ConnectDatabase(models.DatabaseConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	janitor_config, err := store.JanitorConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gorm_store := store.NewGormStore(db)
+	deck_handler := handlers.NewDeckHandler(gorm_store)
+	table_handler := handlers.NewTableHandler(gorm_store, gorm_store)
+	game_handler := handlers.NewGameHandler(gorm_store, gorm_store)
 	r := gin.Default()
 
 	// API v1
 	v1 := r.Group("/api/v1") // versioned API is pretty important
 	{
-		v1.GET("decks", handlers.GetAllDecks)
-		v1.GET("decks/:deck_id", handlers.GetDeckById)
-		v1.POST("decks", handlers.CreateDeck)
-		v1.GET("decks/:deck_id/*draw", handlers.DrawCardsInDeck)
+		v1.GET("decks", deck_handler.GetAllDecks)
+		v1.GET("decks/:deck_id", deck_handler.GetDeckById)
+		v1.POST("decks", deck_handler.CreateDeck)
+		v1.DELETE("decks/:deck_id", deck_handler.DeleteDeck)
+		v1.GET("decks/:deck_id/draw", deck_handler.DrawCardsInDeck)
+		v1.GET("decks/:deck_id/discard", deck_handler.GetDiscardPile)
+		v1.POST("decks/:deck_id/discard/return", deck_handler.ReturnDiscards)
+		v1.POST("decks/:deck_id/shuffle", deck_handler.ShuffleDeck)
+		v1.POST("decks/:deck_id/reveal", deck_handler.RevealDeck)
+		v1.POST("decks/:deck_id/insert", deck_handler.InsertCards)
+		v1.POST("decks/:deck_id/piles/:pile/add", deck_handler.AddToPile)
+		v1.GET("decks/:deck_id/piles/:pile", deck_handler.GetPile)
+		v1.GET("decks/:deck_id/piles/:pile/draw", deck_handler.DrawFromPile)
+		v1.POST("decks/:deck_id/piles/:pile/shuffle", deck_handler.ShufflePile)
+		v1.GET("poker/evaluate", deck_handler.EvaluateHand)
+		v1.POST("tables", table_handler.CreateTable)
+		v1.GET("tables/:table_id", table_handler.GetTable)
+		v1.POST("tables/:table_id/deal", table_handler.Deal)
+		v1.POST("tables/:table_id/hit", table_handler.Hit)
+		v1.POST("tables/:table_id/stand", table_handler.Stand)
+		v1.POST("tables/:table_id/double", table_handler.Double)
+		v1.POST("tables/:table_id/split", table_handler.Split)
+		v1.POST("games", game_handler.CreateGame)
+		v1.GET("games/:game_id", game_handler.GetGame)
+		v1.GET("games/:game_id/players/:player/draw", game_handler.DrawForPlayer)
+		v1.POST("games/:game_id/players/:player/end_turn", game_handler.EndTurn)
 	}
 
-	// By default it serves on :8080 unless a
-	// PORT environment variable was defined.
-	r.Run()
+	var janitor *store.Janitor
+	if janitor_config.TTL > 0 {
+		log.Infof("Deleting decks idle for %s", janitor_config.TTL)
+		janitor = store.StartJanitor(gorm_store, janitor_config)
+	}
+
+	// It serves on :8080 unless a PORT environment variable was defined.
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Info("Listening and serving HTTP on " + server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// stop taking requests on SIGINT or SIGTERM, let the ones in flight
+	// finish and then stop the janitor
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Info("Shutting down")
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdown_ctx); err != nil {
+		log.Error(err)
+	}
+	if janitor != nil {
+		janitor.Stop()
+	}
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Contains the logic for committing to the initial order of a deck. The
+// commitment is published when the deck is created while the salt and the
+// order stay secret until they are revealed after the game. Anyone can then
+// check the revealed order hashes to the commitment, proving the order wasn't
+// changed along the way.
+
+// ComputeCommitment returns the hex encoded SHA-256 of the salt and the
+// comma-separated card codes, separated by a colon.
+func ComputeCommitment(salt string, order string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + order))
+	return hex.EncodeToString(sum[:])
+}
+
+// CommitOrder records a commitment to the order of the cards, from the top of
+// the deck down, using a new random salt.
+func (deck *Deck) CommitOrder(cards []Card) error {
+	salt := make([]byte, 32)
+	if _, err := crypto_rand.Read(salt); err != nil {
+		return err
+	}
+	codes := make([]string, len(cards))
+	for i, card := range cards {
+		card.ComputeCode()
+		codes[i] = card.Code
+	}
+	deck.Salt = hex.EncodeToString(salt)
+	deck.InitialOrder = strings.Join(codes, ",")
+	deck.Commitment = ComputeCommitment(deck.Salt, deck.InitialOrder)
+	return nil
+}
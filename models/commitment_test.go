@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CommitOrder(t *testing.T) {
+	cards := []Card{{Suit: Spades, Value: Ace}, {Suit: Hearts, Value: King}, {Suit: Clubs, Value: Eight}}
+	var deck Deck
+	assert.NoError(t, deck.CommitOrder(cards))
+	assert.Equal(t, "AS,KH,8C", deck.InitialOrder)
+	assert.Len(t, deck.Salt, 64)
+	assert.Equal(t, ComputeCommitment(deck.Salt, deck.InitialOrder), deck.Commitment)
+	// the cards themselves are left alone
+	assert.Empty(t, cards[0].Code)
+
+	// a different order doesn't match the commitment
+	assert.NotEqual(t, deck.Commitment, ComputeCommitment(deck.Salt, "KH,AS,8C"))
+
+	// every commitment has its own salt
+	var other Deck
+	assert.NoError(t, other.CommitOrder(cards))
+	assert.NotEqual(t, deck.Salt, other.Salt)
+	assert.NotEqual(t, deck.Commitment, other.Commitment)
+}
+
+func Test_ComputeCommitment(t *testing.T) {
+	// sha256 of "salt:AS,KH"
+	assert.Equal(t, "74d4f5f3140f6e2fdedad72e203a37458e075b1db49a9dda9dd7796fad01845d", ComputeCommitment("salt", "AS,KH"))
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Contains the logic for connecting to the configured database
+
+const SQLITE_DRIVER = "sqlite"
+const POSTGRES_DRIVER = "postgres"
+
+// The DSN used when no DSN is configured for sqlite. Data is lost once the
+// server terminates.
+const SQLITE_MEMORY_DSN = "file::memory:?cache=shared"
+
+// DatabaseConfig selects the driver and data source the server connects to.
+type DatabaseConfig struct {
+	Driver string
+	DSN    string
+}
+
+// DatabaseConfigFromEnv reads the database configuration from the DB_DRIVER
+// and DB_DSN environment variables. When neither is set the in-memory sqlite
+// database is used.
+func DatabaseConfigFromEnv() DatabaseConfig {
+	return DatabaseConfig{Driver: os.Getenv("DB_DRIVER"), DSN: os.Getenv("DB_DSN")}
+}
+
+// The options every file backed sqlite DSN is opened with, unless the DSN
+// sets them itself
+var SQLITE_OPTIONS = []string{"_journal_mode=WAL", "_busy_timeout=5000", "_txlock=immediate"}
+
+// sqliteDSN turns a file path into a DSN with write-ahead logging enabled so
+// readers aren't blocked by a writer. Transactions take the write lock up
+// front and wait for it rather than failing when another writer holds it.
+// Options the DSN already carries are kept and only the missing ones are
+// added. In-memory DSNs are returned untouched.
+func sqliteDSN(dsn string) string {
+	if dsn == "" {
+		return SQLITE_MEMORY_DSN
+	}
+	if isSqliteMemory(dsn) {
+		return dsn
+	}
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	path, query, _ := strings.Cut(dsn, "?")
+	options := []string{}
+	if query != "" {
+		options = strings.Split(query, "&")
+	}
+	for _, option := range SQLITE_OPTIONS {
+		name, _, _ := strings.Cut(option, "=")
+		if !hasSqliteOption(options, name) {
+			options = append(options, option)
+		}
+	}
+	return path + "?" + strings.Join(options, "&")
+}
+
+func hasSqliteOption(options []string, name string) bool {
+	for _, option := range options {
+		if option_name, _, _ := strings.Cut(option, "="); option_name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isSqliteMemory(dsn string) bool {
+	return strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+func openDialector(config DatabaseConfig) (gorm.Dialector, error) {
+	switch strings.ToLower(config.Driver) {
+	case "", SQLITE_DRIVER, "sqlite3":
+		return sqlite.Open(sqliteDSN(config.DSN)), nil
+	case POSTGRES_DRIVER, "postgresql":
+		if config.DSN == "" {
+			return nil, fmt.Errorf("DB_DSN is required for driver %s", config.Driver)
+		}
+		return postgres.Open(config.DSN), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", config.Driver)
+}
+
+// ConnectDatabase opens the configured database and migrates it to the
+// latest schema.
+func ConnectDatabase(config DatabaseConfig) (*gorm.DB, error) {
+	log.Info("Connecting to database")
+
+	dialector, err := openDialector(config)
+	if err != nil {
+		msg := fmt.Errorf("db connection error: %s", err)
+		log.Error(msg)
+		return nil, msg
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		msg := fmt.Errorf("db connection error: %s", err)
+		log.Error(msg)
+		return nil, msg
+	}
+
+	if db.Dialector.Name() == SQLITE_DRIVER && isSqliteMemory(sqliteDSN(config.DSN)) {
+		// a shared cache in-memory database locks whole tables and fails
+		// rather than waiting, so every query goes through one connection
+		sql_db, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sql_db.SetMaxOpenConns(1)
+	}
+
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_sqliteDSN(t *testing.T) {
+	assert.Equal(t, SQLITE_MEMORY_DSN, sqliteDSN(""))
+	assert.Equal(t, "file::memory:?cache=shared", sqliteDSN("file::memory:?cache=shared"))
+	assert.Equal(t, "file:cards.db?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("cards.db"))
+	assert.Equal(t, "file:cards.db?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("file:cards.db"))
+	assert.Equal(t, "file:cards.db?cache=shared&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("cards.db?cache=shared"))
+	assert.Equal(t, "file:cards.db?_busy_timeout=100&_journal_mode=WAL&_txlock=immediate", sqliteDSN("file:cards.db?_busy_timeout=100"))
+	assert.Equal(t, "file:/var/lib/cards.db?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate", sqliteDSN("/var/lib/cards.db"))
+}
+
+func Test_openDialector_Invalid(t *testing.T) {
+	for _, config := range []DatabaseConfig{{Driver: "mysql"}, {Driver: POSTGRES_DRIVER}} {
+		_, err := openDialector(config)
+		assert.Error(t, err, config.Driver)
+	}
+}
+
+// Test_Migrate_CarriesRowsForward migrates a file backed database, writes a
+// deck, then reopens and migrates it again to check the rows survive.
+func Test_Migrate_CarriesRowsForward(t *testing.T) {
+	dsn := sqliteDSN(filepath.Join(t.TempDir(), "cards.db"))
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, db.Create(&Deck{Id: "deck", Remaining: 1}).Error)
+	assert.NoError(t, db.Create(&Card{Id: "card", Suit: Spades, Value: Ace, DeckId: "deck"}).Error)
+	sql_db, _ := db.DB()
+	sql_db.Close()
+
+	db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, Migrate(db))
+
+	var deck Deck
+	assert.NoError(t, db.First(&deck, "id = ?", "deck").Error)
+	assert.EqualValues(t, 1, deck.Remaining)
+	var card Card
+	assert.NoError(t, db.First(&card, "id = ?", "card").Error)
+	assert.Equal(t, Spades, card.Suit)
+
+	var applied int64
+	db.Model(&SchemaMigration{}).Count(&applied)
+	assert.EqualValues(t, len(migrations), applied)
+}
+
+type cardPosition struct {
+	Id       string
+	Position int
+}
+
+// Test_Migrate_CardPosition checks cards created before positions existed are
+// numbered in the order they were created.
+func Test_Migrate_CardPosition(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(filepath.Join(t.TempDir(), "cards.db"))), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, applyMigrations(db, migrations[:2]))
+
+	type Card struct {
+		Id        string
+		Suit      string
+		Value     string
+		DeckId    string
+		CreatedAt time.Time
+	}
+	now := time.Now()
+	for i, id := range []string{"c", "a", "b"} {
+		assert.NoError(t, db.Create(&Card{Id: id, Suit: "SPADES", Value: "Ace", DeckId: "deck", CreatedAt: now.Add(time.Duration(i) * time.Second)}).Error)
+	}
+	assert.NoError(t, db.Create(&Card{Id: "other", Suit: "SPADES", Value: "Ace", DeckId: "other", CreatedAt: now}).Error)
+	assert.NoError(t, Migrate(db))
+
+	var cards []cardPosition
+	assert.NoError(t, db.Table("cards").Where("deck_id = ?", "deck").Order("position").Find(&cards).Error)
+	assert.Equal(t, []cardPosition{{"c", 0}, {"a", 1}, {"b", 2}}, cards)
+}
+
+type cardEnums struct {
+	Id    string
+	Suit  int
+	Value int
+}
+
+// Test_Migrate_CardEnums checks the suits and values cards were stored with
+// as names are converted to their enums, and the cards that can't be played
+// are deleted and no longer counted by their deck or pile.
+func Test_Migrate_CardEnums(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(filepath.Join(t.TempDir(), "cards.db"))), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, applyMigrations(db, migrations[:9]))
+
+	type Card struct {
+		Id       string
+		Suit     string
+		Value    string
+		DeckId   string
+		Pile     string
+		Position int
+	}
+	type Deck struct {
+		Id        string
+		Remaining int
+	}
+	type Pile struct {
+		Id        string
+		DeckId    string
+		Name      string
+		Remaining int
+	}
+	for i, card := range []Card{{Id: "a", Suit: "SPADES", Value: "Ace"}, {Id: "b", Suit: "HEARTS", Value: "10"},
+		{Id: "c", Suit: "DIAMONDS", Value: "King"}, {Id: "d", Suit: "RED", Value: "Joker"}, {Id: "e", Suit: "unknown", Value: "1"},
+		{Id: "f", Suit: "CLUBS", Value: "1", Pile: "alice"}, {Id: "g", Suit: "CLUBS", Value: "2", Pile: "alice"}} {
+		card.DeckId, card.Position = "deck", i
+		assert.NoError(t, db.Create(&card).Error)
+	}
+	assert.NoError(t, db.Create(&Deck{Id: "deck", Remaining: 5}).Error)
+	assert.NoError(t, db.Create(&Deck{Id: "other", Remaining: 3}).Error)
+	assert.NoError(t, db.Create(&Pile{Id: "pile", DeckId: "deck", Name: "alice", Remaining: 2}).Error)
+	assert.NoError(t, Migrate(db))
+
+	var cards []cardEnums
+	assert.NoError(t, db.Table("cards").Order("position").Find(&cards).Error)
+	assert.Equal(t, []cardEnums{{"a", int(Spades), int(Ace)}, {"b", int(Hearts), int(Ten)},
+		{"c", int(Diamonds), int(King)}, {"d", int(Red), int(Joker)}, {"g", int(Clubs), int(Two)}}, cards)
+	assert.True(t, db.Migrator().HasIndex("cards", "idx_cards_deck_pile_position"))
+
+	var remaining []int
+	assert.NoError(t, db.Table("decks").Order("id").Pluck("remaining", &remaining).Error)
+	assert.Equal(t, []int{4, 3}, remaining)
+	assert.NoError(t, db.Table("piles").Pluck("remaining", &remaining).Error)
+	assert.Equal(t, []int{1}, remaining)
+}
+
+// Test_Migrate_DeckGame checks the decks of games created before decks knew
+// their game are marked as played by them.
+func Test_Migrate_DeckGame(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(sqliteDSN(filepath.Join(t.TempDir(), "cards.db"))), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, applyMigrations(db, migrations[:13]))
+
+	type Deck struct {
+		Id string
+	}
+	type Game struct {
+		Id     string
+		DeckId string
+	}
+	for _, id := range []string{"played", "free"} {
+		assert.NoError(t, db.Create(&Deck{Id: id}).Error)
+	}
+	assert.NoError(t, db.Create(&Game{Id: "game", DeckId: "played"}).Error)
+	assert.NoError(t, Migrate(db))
+
+	var game_ids []sql.NullString
+	assert.NoError(t, db.Table("decks").Order("id").Pluck("game_id", &game_ids).Error)
+	assert.Equal(t, []sql.NullString{{}, {String: "game", Valid: true}}, game_ids)
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"sort"
+)
+
+// Contains the kinds of decks that can be created
+
+// The deck type created when none is given
+const STANDARD_DECK = "standard52"
+
+// A kind of deck, made of every value in every suit along with any jokers
+type DeckType struct {
+	Name   string
+	Suits  []Suit
+	Values []Value
+	// the number of copies of every suited card
+	Copies int
+	// the colours of the jokers in the deck
+	Jokers []Suit
+}
+
+var all_suits = []Suit{Spades, Clubs, Hearts, Diamonds}
+
+var deck_types = map[string]DeckType{
+	STANDARD_DECK: {
+		Name:   STANDARD_DECK,
+		Suits:  all_suits,
+		Values: []Value{Ace, Two, Three, Four, Five, Six, Seven, Eight, Nine, Ten, Jack, Queen, King},
+		Copies: 1,
+	},
+	"jokers54": {
+		Name:   "jokers54",
+		Suits:  all_suits,
+		Values: []Value{Ace, Two, Three, Four, Five, Six, Seven, Eight, Nine, Ten, Jack, Queen, King},
+		Copies: 1,
+		Jokers: []Suit{Black, Red},
+	},
+	"piquet32": {
+		Name:   "piquet32",
+		Suits:  all_suits,
+		Values: []Value{Ace, Seven, Eight, Nine, Ten, Jack, Queen, King},
+		Copies: 1,
+	},
+	"euchre24": {
+		Name:   "euchre24",
+		Suits:  all_suits,
+		Values: []Value{Ace, Nine, Ten, Jack, Queen, King},
+		Copies: 1,
+	},
+	"pinochle48": {
+		Name:   "pinochle48",
+		Suits:  all_suits,
+		Values: []Value{Ace, Nine, Ten, Jack, Queen, King},
+		Copies: 2,
+	},
+}
+
+// GetDeckType returns the deck type with the given name.
+func GetDeckType(name string) (DeckType, bool) {
+	deck_type, ok := deck_types[name]
+	return deck_type, ok
+}
+
+// DeckTypeNames returns the names of all the deck types in order.
+func DeckTypeNames() []string {
+	var names []string
+	for name := range deck_types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Cards returns the cards of a single deck of this type, suit by suit
+// followed by the jokers. The cards don't have ids yet.
+func (deck_type DeckType) Cards() []Card {
+	var cards []Card
+	for _, suit := range deck_type.Suits {
+		for _, value := range deck_type.Values {
+			for i := 0; i < deck_type.Copies; i++ {
+				cards = append(cards, NewCard(suit, value))
+			}
+		}
+	}
+	for _, colour := range deck_type.Jokers {
+		cards = append(cards, NewCard(colour, Joker))
+	}
+	return cards
+}
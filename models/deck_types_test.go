@@ -0,0 +1,67 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// composition counts how many times every card appears.
+func composition(cards []Card) map[string]int {
+	counts := map[string]int{}
+	for _, card := range cards {
+		counts[card.Value.String()+" "+card.Suit.String()]++
+	}
+	return counts
+}
+
+// suitedComposition is the composition of copies of every value in every
+// suit.
+func suitedComposition(copies int, values ...string) map[string]int {
+	counts := map[string]int{}
+	for _, suit := range []string{"SPADES", "CLUBS", "HEARTS", "DIAMONDS"} {
+		for _, value := range values {
+			counts[value+" "+suit] = copies
+		}
+	}
+	return counts
+}
+
+func Test_DeckType_Cards(t *testing.T) {
+	standard := suitedComposition(1, "Ace", "2", "3", "4", "5", "6", "7", "8", "9", "10", "Jack", "Queen", "King")
+	with_jokers := suitedComposition(1, "Ace", "2", "3", "4", "5", "6", "7", "8", "9", "10", "Jack", "Queen", "King")
+	with_jokers["Joker BLACK"] = 1
+	with_jokers["Joker RED"] = 1
+
+	for _, test := range []struct {
+		name        string
+		size        int
+		composition map[string]int
+	}{
+		{"standard52", 52, standard},
+		{"jokers54", 54, with_jokers},
+		{"piquet32", 32, suitedComposition(1, "Ace", "7", "8", "9", "10", "Jack", "Queen", "King")},
+		{"euchre24", 24, suitedComposition(1, "Ace", "9", "10", "Jack", "Queen", "King")},
+		{"pinochle48", 48, suitedComposition(2, "Ace", "9", "10", "Jack", "Queen", "King")},
+	} {
+		deck_type, ok := GetDeckType(test.name)
+		assert.True(t, ok, test.name)
+		cards := deck_type.Cards()
+		assert.Len(t, cards, test.size, test.name)
+		assert.Equal(t, test.composition, composition(cards), test.name)
+	}
+}
+
+func Test_GetDeckType_Unknown(t *testing.T) {
+	_, ok := GetDeckType("tarot78")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"euchre24", "jokers54", "pinochle48", "piquet32", "standard52"}, DeckTypeNames())
+}
+
+func Test_ComputeCode_Joker(t *testing.T) {
+	black, red := Card{Suit: Black, Value: Joker}, Card{Suit: Red, Value: Joker}
+	black.ComputeCode()
+	red.ComputeCode()
+	assert.Equal(t, "X1", black.Code)
+	assert.Equal(t, "X2", red.Code)
+}
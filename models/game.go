@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// A game seats players around a deck. Every player draws into a hand of their
+// own, which is the pile of the deck named after them, and takes turns in the
+// order they were seated
+type Game struct {
+	Id      string   `gorm:"primaryKey" json:"game_id"`
+	DeckId  string   `json:"deck_id"`
+	Players []string `gorm:"serializer:json" json:"players"`
+	// the index of the player whose turn it is
+	Turn      int       `json:"turn"`
+	Version   int       `json:"-" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// CurrentPlayer returns the player whose turn it is.
+func (game *Game) CurrentPlayer() string {
+	return game.Players[game.Turn]
+}
+
+// HasPlayer reports whether the player is seated at the game.
+func (game *Game) HasPlayer(player string) bool {
+	for _, seated := range game.Players {
+		if seated == player {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Contains the versioned schema migrations. Every migration is applied once,
+// in order, and recorded in the schema_migrations table so that the rows of
+// an existing database are carried forward on upgrade. Migrations declare
+// their own copies of the models so they keep working as the models change.
+// New migrations must be appended to the end of the list.
+
+type Migration struct {
+	Id      string
+	Migrate func(tx *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Id        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+var migrations = []Migration{
+	{
+		Id: "0001_create_decks_and_cards",
+		Migrate: func(tx *gorm.DB) error {
+			type Card struct {
+				Id        string `gorm:"primaryKey"`
+				Suit      string
+				Value     string
+				DeckId    string
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			type Deck struct {
+				Id        string `gorm:"primaryKey"`
+				Shuffled  bool
+				Remaining int
+				CreatedAt time.Time `gorm:"index"`
+				UpdatedAt time.Time
+			}
+			return tx.AutoMigrate(&Card{}, &Deck{})
+		},
+	},
+	{
+		Id: "0002_add_deck_version",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				Version int `gorm:"not null;default:0"`
+			}
+			return tx.Migrator().AddColumn(&Deck{}, "Version")
+		},
+	},
+	{
+		Id: "0003_add_card_position",
+		Migrate: func(tx *gorm.DB) error {
+			type Card struct {
+				DeckId   string `gorm:"index:idx_cards_deck_position"`
+				Position int    `gorm:"not null;default:0;index:idx_cards_deck_position"`
+			}
+			if err := tx.Migrator().AddColumn(&Card{}, "Position"); err != nil {
+				return err
+			}
+			// existing cards keep the order they were created in
+			if err := tx.Exec(`UPDATE cards SET position = (
+				SELECT COUNT(*) FROM cards AS previous
+				WHERE previous.deck_id = cards.deck_id
+				AND (previous.created_at < cards.created_at
+					OR (previous.created_at = cards.created_at AND previous.id < cards.id)))`).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&Card{}, "idx_cards_deck_position")
+		},
+	},
+	{
+		Id: "0004_add_card_pile",
+		Migrate: func(tx *gorm.DB) error {
+			type Card struct {
+				DeckId   string `gorm:"index:idx_cards_deck_pile_position"`
+				Pile     string `gorm:"not null;default:'';index:idx_cards_deck_pile_position"`
+				Position int    `gorm:"index:idx_cards_deck_pile_position"`
+				DrawnAt  *time.Time
+			}
+			if err := tx.Migrator().DropIndex(&Card{}, "idx_cards_deck_position"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&Card{}, "Pile"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().AddColumn(&Card{}, "DrawnAt"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&Card{}, "idx_cards_deck_pile_position")
+		},
+	},
+	{
+		Id: "0005_create_piles",
+		Migrate: func(tx *gorm.DB) error {
+			type Pile struct {
+				Id        string `gorm:"primaryKey"`
+				DeckId    string `gorm:"uniqueIndex:idx_piles_deck_name"`
+				Name      string `gorm:"uniqueIndex:idx_piles_deck_name"`
+				Remaining int
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			return tx.AutoMigrate(&Pile{})
+		},
+	},
+	{
+		Id: "0006_add_deck_seed",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				Seed     *int64
+				Shuffles int `gorm:"not null;default:0"`
+			}
+			if err := tx.Migrator().AddColumn(&Deck{}, "Seed"); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&Deck{}, "Shuffles")
+		},
+	},
+	{
+		Id: "0007_add_deck_commitment",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				ShuffleMode  string `gorm:"not null;default:standard"`
+				Commitment   string
+				Salt         string
+				InitialOrder string
+			}
+			for _, field := range []string{"ShuffleMode", "Commitment", "Salt", "InitialOrder"} {
+				if err := tx.Migrator().AddColumn(&Deck{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, {
+		Id: "0008_add_deck_count",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				DeckCount int `gorm:"not null;default:1"`
+			}
+			return tx.Migrator().AddColumn(&Deck{}, "DeckCount")
+		},
+	}, {
+		Id: "0009_add_deck_type",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				DeckType string
+			}
+			return tx.Migrator().AddColumn(&Deck{}, "DeckType")
+		},
+	}, {
+		Id: "0010_store_card_enums",
+		Migrate: func(tx *gorm.DB) error {
+			// the cards are copied into a new table with integer suits and
+			// values, since neither database can convert the columns in
+			// place the same way
+			type Card struct {
+				Id        string `gorm:"primaryKey"`
+				Suit      int    `gorm:"not null"`
+				Value     int    `gorm:"not null"`
+				DeckId    string `gorm:"index:idx_cards_deck_pile_position"`
+				Pile      string `gorm:"not null;default:'';index:idx_cards_deck_pile_position"`
+				Position  int    `gorm:"not null;default:0;index:idx_cards_deck_pile_position"`
+				DrawnAt   *time.Time
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			suits := []string{"SPADES", "CLUBS", "HEARTS", "DIAMONDS", "BLACK", "RED"}
+			values := []string{"ACE", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "JACK", "QUEEN", "KING", "JOKER"}
+			// toEnum converts the names in the column to their index
+			toEnum := func(column string, names []string) string {
+				sql := "CASE UPPER(" + column + ")"
+				for i, name := range names {
+					sql += fmt.Sprintf(" WHEN '%s' THEN %d", name, i)
+				}
+				return sql + " END"
+			}
+			// oneOf matches the names in the column
+			oneOf := func(column string, names []string) string {
+				return "UPPER(" + column + ") IN ('" + strings.Join(names, "', '") + "')"
+			}
+			// cards of an unknown suit or value, or of the value 1 which isn't
+			// a card, can't be played and are left behind
+			playable := oneOf("suit", suits) + " AND " + oneOf("value", append([]string{values[0]}, values[2:]...))
+
+			if err := tx.Migrator().DropIndex(&Card{}, "idx_cards_deck_pile_position"); err != nil {
+				return err
+			}
+			if err := tx.Table("cards_enums").Migrator().CreateTable(&Card{}); err != nil {
+				return err
+			}
+			if err := tx.Exec(`INSERT INTO cards_enums (id, suit, value, deck_id, pile, position, drawn_at, created_at, updated_at)
+				SELECT id, ` + toEnum("suit", suits) + `, ` + toEnum("value", values) + `, deck_id, pile, position, drawn_at, created_at, updated_at
+				FROM cards WHERE ` + playable).Error; err != nil {
+				return err
+			}
+			// the decks and piles no longer count the cards left behind
+			left_behind := "SELECT COUNT(*) FROM cards WHERE cards.id NOT IN (SELECT id FROM cards_enums) AND cards.deck_id = "
+			if err := tx.Exec("UPDATE decks SET remaining = remaining - (" + left_behind + "decks.id AND cards.pile = '')").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE piles SET remaining = remaining - (" + left_behind + "piles.deck_id AND cards.pile = piles.name)").Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropTable("cards"); err != nil {
+				return err
+			}
+			return tx.Migrator().RenameTable("cards_enums", "cards")
+		},
+	}, {
+		Id: "0011_create_tables",
+		Migrate: func(tx *gorm.DB) error {
+			type Table struct {
+				Id        string `gorm:"primaryKey"`
+				DeckId    string
+				Seats     int
+				HitSoft17 bool
+				Status    string
+				Turn      int
+				Hands     string
+				Dealer    string
+				Version   int `gorm:"not null;default:0"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			return tx.AutoMigrate(&Table{})
+		},
+	}, {
+		Id: "0012_create_games",
+		Migrate: func(tx *gorm.DB) error {
+			type Game struct {
+				Id        string `gorm:"primaryKey"`
+				DeckId    string
+				Players   string
+				Turn      int
+				Version   int `gorm:"not null;default:0"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			return tx.AutoMigrate(&Game{})
+		},
+	}, {
+		Id: "0013_add_deck_table",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				TableId string
+			}
+			return tx.Migrator().AddColumn(&Deck{}, "TableId")
+		},
+	}, {
+		Id: "0014_add_deck_game",
+		Migrate: func(tx *gorm.DB) error {
+			type Deck struct {
+				GameId string
+			}
+			if err := tx.Migrator().AddColumn(&Deck{}, "GameId"); err != nil {
+				return err
+			}
+			// the decks of the games created before the column existed
+			return tx.Exec("UPDATE decks SET game_id = (SELECT MIN(games.id) FROM games WHERE games.deck_id = decks.id) " +
+				"WHERE EXISTS (SELECT 1 FROM games WHERE games.deck_id = decks.id)").Error
+		},
+	},
+}
+
+// Migrate brings the schema of db up to date by applying every migration
+// that hasn't been applied yet.
+func Migrate(db *gorm.DB) error {
+	return applyMigrations(db, migrations)
+}
+
+func applyMigrations(db *gorm.DB, migrations []Migration) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	var applied []SchemaMigration
+	if result := db.Find(&applied); result.Error != nil {
+		return result.Error
+	}
+	done := make(map[string]bool, len(applied))
+	for _, migration := range applied {
+		done[migration.Id] = true
+	}
+
+	for _, migration := range migrations {
+		if done[migration.Id] {
+			continue
+		}
+		log.Info("Applying migration " + migration.Id)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Migrate(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Id: migration.Id, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			log.Errorf("Failed to apply migration %s", migration.Id)
+			return err
+		}
+	}
+	return nil
+}
@@ -1,19 +1,15 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
-// Contains some helper logic for manipulating the models
-
-var DB *gorm.DB
+// Contains some helper logic for manipulating the models, along with the codec
+// converting between the Suit and Value enums, their display names and card
+// codes such as "AS", "10H" or "X1"
 
 type Suit int64
 type Value int64
@@ -23,6 +19,9 @@ const (
 	Clubs
 	Hearts
 	Diamonds
+	// jokers don't have a suit but come in two colours
+	Black
+	Red
 )
 
 const (
@@ -40,8 +39,21 @@ const (
 	Jack
 	Queen
 	King
+	Joker
 )
 
+// The codes of the black and red jokers
+const BLACK_JOKER_CODE = "X1"
+const RED_JOKER_CODE = "X2"
+
+// Every suit and value a card can have, jokers last. One isn't a card.
+var SUITS = []Suit{Spades, Clubs, Hearts, Diamonds, Black, Red}
+var VALUES = []Value{Ace, Two, Three, Four, Five, Six, Seven, Eight, Nine, Ten, Jack, Queen, King, Joker}
+
+var suit_codes = map[Suit]string{Spades: "S", Clubs: "C", Hearts: "H", Diamonds: "D"}
+var value_codes = map[Value]string{Ace: "A", Two: "2", Three: "3", Four: "4", Five: "5", Six: "6", Seven: "7",
+	Eight: "8", Nine: "9", Ten: "10", Jack: "J", Queen: "Q", King: "K"}
+
 func (s Suit) String() string {
 	switch s {
 	case Spades:
@@ -52,6 +64,10 @@ func (s Suit) String() string {
 		return "HEARTS"
 	case Diamonds:
 		return "DIAMONDS"
+	case Black:
+		return "BLACK"
+	case Red:
+		return "RED"
 	}
 	return "unknown"
 }
@@ -66,47 +82,130 @@ func (v Value) String() string {
 		return "King"
 	case Ace:
 		return "Ace"
+	case Joker:
+		return "Joker"
 	}
 	values := []string{"A", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
-	if int(v) >= len(values) {
+	if v < 0 || int(v) >= len(values) {
 		return "unknown"
 	}
 	return values[v]
 }
 
+// MarshalJSON writes the suit as its display name.
+func (s Suit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON reads the suit from its display name.
+func (s *Suit) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	suit, err := SuitFromName(name)
+	if err != nil {
+		return err
+	}
+	*s = suit
+	return nil
+}
+
+// MarshalJSON writes the value as its display name.
+func (v Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+// UnmarshalJSON reads the value from its display name.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	value, err := ValueFromName(name)
+	if err != nil {
+		return err
+	}
+	*v = value
+	return nil
+}
+
+// Code returns the letter of the suit in card codes, which is empty for the
+// joker colours.
+func (s Suit) Code() string {
+	return suit_codes[s]
+}
+
+// Code returns the value's part of card codes, which is empty for jokers.
+func (v Value) Code() string {
+	return value_codes[v]
+}
+
+// ToSuit parses the suit's letter in a card code.
 func ToSuit(s string) (Suit, error) {
-	switch strings.ToUpper(s) {
-	case "S":
-		return Spades, nil
-	case "C":
-		return Clubs, nil
-	case "H":
-		return Hearts, nil
-	case "D":
-		return Diamonds, nil
+	for _, suit := range SUITS {
+		if suit_codes[suit] != "" && strings.ToUpper(s) == suit_codes[suit] {
+			return suit, nil
+		}
 	}
 	return -1, errors.New("invalid suit " + s)
 }
 
+// ToValue parses the value's part of a card code. A ten is "10", "0" or "T".
 func ToValue(s string) (Value, error) {
-	switch strings.ToUpper(s) {
-	case "A":
-		return Ace, nil
-	case "J":
-		return Jack, nil
-	case "Q":
-		return Queen, nil
-	case "K":
-		return King, nil
+	code := strings.ToUpper(s)
+	if code == "0" || code == "T" {
+		return Ten, nil
 	}
-	if value, err := strconv.Atoi(s); err != nil {
-		return Value(0), err
-	} else {
-		return Value(value), nil
+	for _, value := range VALUES {
+		if value_codes[value] != "" && code == value_codes[value] {
+			return value, nil
+		}
+	}
+	return -1, errors.New("invalid value " + s)
+}
+
+// SuitFromName parses the display name of a suit, ignoring case.
+func SuitFromName(name string) (Suit, error) {
+	for _, suit := range SUITS {
+		if strings.EqualFold(name, suit.String()) {
+			return suit, nil
+		}
 	}
+	return -1, errors.New("invalid suit " + name)
+}
+
+// ValueFromName parses the display name of a value, ignoring case.
+func ValueFromName(name string) (Value, error) {
+	for _, value := range VALUES {
+		if strings.EqualFold(name, value.String()) {
+			return value, nil
+		}
+	}
+	return -1, errors.New("invalid value " + name)
+}
+
+// CardCode returns the code of the card with the suit and value, which
+// CodeToSuitValue parses back.
+func CardCode(suit Suit, value Value) string {
+	if value == Joker {
+		if suit == Red {
+			return RED_JOKER_CODE
+		}
+		return BLACK_JOKER_CODE
+	}
+	return value.Code() + suit.Code()
 }
 
 func CodeToSuitValue(code string) (*Suit, *Value, error) {
+	switch strings.ToUpper(code) {
+	case BLACK_JOKER_CODE:
+		suit, value := Black, Joker
+		return &suit, &value, nil
+	case RED_JOKER_CODE:
+		suit, value := Red, Joker
+		return &suit, &value, nil
+	}
 	if len(code) != 2 && len(code) != 3 {
 		return nil, nil, fmt.Errorf("invalid code: '"+code+"' length: %d", len(code))
 	}
@@ -121,26 +220,18 @@ func CodeToSuitValue(code string) (*Suit, *Value, error) {
 	return &suit, &value, nil
 }
 
-func (card *Card) ComputeCode() {
-	card.Code = card.Value[:1] + card.Suit[:1]
+// NewCard returns a card with the suit and value along with its code. The
+// card doesn't have an id yet.
+func NewCard(suit Suit, value Value) Card {
+	return Card{Suit: suit, Value: value, Code: CardCode(suit, value)}
 }
 
-func ConnectDatabase() error {
-	log.Info("Connecting to database")
-
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	if err != nil {
-		msg := fmt.Errorf("db connection error: %s", err)
-		log.Error(msg)
-		panic(msg)
-	}
-
-	if err := db.AutoMigrate(&Card{}); err != nil {
-		panic(err)
-	}
-	if err := db.AutoMigrate(&Deck{}); err != nil {
-		panic(err)
+// ComputeCode sets the code of the card from its suit and value, leaving it
+// empty when they aren't a valid card.
+func (card *Card) ComputeCode() {
+	if card.Value != Joker && (card.Suit.Code() == "" || card.Value.Code() == "") {
+		card.Code = ""
+		return
 	}
-	DB = db
-	return nil
+	card.Code = CardCode(card.Suit, card.Value)
 }
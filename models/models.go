@@ -4,20 +4,58 @@ import (
 	"time"
 )
 
+// The pile of the cards that are still in the deck
+const DECK_PILE = ""
+
+// The pile drawn cards are moved to
+const DISCARD_PILE = "discard"
+
 type Card struct {
-	Id        string    `gorm:"primaryKey" json:"-"`
-	Suit      string    `json:"suit"`
-	Value     string    `json:"value"`
-	DeckId    string    `gorm:"foreignKey" json:"-"`
-	Code      string    `gorm:"-:all" json:"code"`
-	CreatedAt time.Time `json:"-"`
-	UpdatedAt time.Time `json:"-"`
+	Id        string     `gorm:"primaryKey" json:"-"`
+	Suit      Suit       `gorm:"not null" json:"suit"`
+	Value     Value      `gorm:"not null" json:"value"`
+	DeckId    string     `gorm:"foreignKey;index:idx_cards_deck_pile_position" json:"-"`
+	Pile      string     `gorm:"not null;default:'';index:idx_cards_deck_pile_position" json:"-"`
+	Position  int        `gorm:"not null;default:0;index:idx_cards_deck_pile_position" json:"-"`
+	Code      string     `gorm:"-:all" json:"code"`
+	DrawnAt   *time.Time `json:"drawn_at,omitempty"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
 }
 
 type Deck struct {
-	Id        string    `gorm:"primaryKey" json:"deck_id"`
-	Shuffled  bool      `json:"shuffled"`
-	Remaining int       `json:"remaining"`
+	Id        string `gorm:"primaryKey" json:"deck_id"`
+	Shuffled  bool   `json:"shuffled"`
+	Remaining int    `json:"remaining"`
+	// the type of the full decks shuffled together into the deck, which
+	// is empty for custom decks
+	DeckType  string `json:"deck_type,omitempty"`
+	DeckCount int    `json:"deck_count" gorm:"not null;default:1"`
+	Seed      *int64 `json:"seed,omitempty"`
+	Shuffles  int    `json:"-" gorm:"not null;default:0"`
+	// the shuffle mode and, for secure decks, the commitment to the
+	// initial order along with the secrets that reveal it
+	ShuffleMode  string `json:"shuffle_mode" gorm:"not null;default:standard"`
+	Commitment   string `json:"commitment,omitempty"`
+	Salt         string `json:"-"`
+	InitialOrder string `json:"-"`
+	// the table the deck is the shoe of, whose cards are only played
+	// through the table
+	TableId string `json:"-"`
+	// the game playing with the deck, whose players only draw from it
+	// through the game
+	GameId    string    `json:"-"`
+	Version   int       `json:"-" gorm:"not null;default:0"`
 	CreatedAt time.Time `json:"-" gorm:"index"`
 	UpdatedAt time.Time `json:"-"`
 }
+
+// A named pile of cards, such as a player's hand, taken from a deck
+type Pile struct {
+	Id        string    `gorm:"primaryKey" json:"-"`
+	DeckId    string    `gorm:"uniqueIndex:idx_piles_deck_name" json:"-"`
+	Name      string    `gorm:"uniqueIndex:idx_piles_deck_name" json:"name"`
+	Remaining int       `json:"remaining"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
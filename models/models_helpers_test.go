@@ -1,8 +1,11 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"testing/quick"
 )
 
 func Test_CodeToSuitValue_Invalid(t *testing.T) {
@@ -44,3 +47,117 @@ func Test_ValueString_Invalid(t *testing.T) {
 
 	}
 }
+
+func Test_CodeToSuitValue_Joker(t *testing.T) {
+	for code, expected := range map[string]Suit{"X1": Black, "x1": Black, "X2": Red} {
+		suit, value, err := CodeToSuitValue(code)
+		if err != nil || *suit != expected || *value != Joker {
+			t.Fatalf(`CodeToSuitValue(%q) = %v, %v, %v, want %v, %v, nil`, code, suit, value, err, expected, Joker)
+		}
+	}
+	for _, code := range []string{"X", "X3", "X0", "XS"} {
+		if _, _, err := CodeToSuitValue(code); err == nil {
+			t.Fatalf(`CodeToSuitValue(%q) = _, _, nil, want error`, code)
+		}
+	}
+}
+
+func Test_Card_Joker_JSON(t *testing.T) {
+	suit, value, _ := CodeToSuitValue("X2")
+	card := Card{Suit: *suit, Value: *value}
+	card.ComputeCode()
+	result, err := json.Marshal(card)
+	expected := `{"suit":"RED","value":"Joker","code":"X2"}`
+	if err != nil || string(result) != expected {
+		t.Fatalf(`json.Marshal(%v) = %s, %v, want %s, nil`, card, result, err, expected)
+	}
+}
+
+// allCards returns every card there is: every value in every suit along with
+// the two jokers.
+func allCards() []Card {
+	var cards []Card
+	for _, suit := range []Suit{Spades, Clubs, Hearts, Diamonds} {
+		for _, value := range VALUES {
+			if value != Joker {
+				cards = append(cards, NewCard(suit, value))
+			}
+		}
+	}
+	return append(cards, NewCard(Black, Joker), NewCard(Red, Joker))
+}
+
+// Test_CardCode_RoundTrip checks the code of every card parses back to the
+// same card, and that its display names do too.
+func Test_CardCode_RoundTrip(t *testing.T) {
+	seen := map[string]bool{}
+	for _, card := range allCards() {
+		suit, value := card.Suit, card.Value
+		code := CardCode(suit, value)
+		if seen[code] {
+			t.Fatalf(`CardCode(%v, %v) = %q, which another card already has`, suit, value, code)
+		}
+		seen[code] = true
+
+		parsed_suit, parsed_value, err := CodeToSuitValue(code)
+		if err != nil || *parsed_suit != suit || *parsed_value != value {
+			t.Fatalf(`CodeToSuitValue(%q) = %v, %v, %v, want %v, %v, nil`, code, parsed_suit, parsed_value, err, suit, value)
+		}
+		if named, err := SuitFromName(suit.String()); err != nil || named != suit {
+			t.Fatalf(`SuitFromName(%q) = %v, %v, want %v, nil`, suit.String(), named, err, suit)
+		}
+		if named, err := ValueFromName(value.String()); err != nil || named != value {
+			t.Fatalf(`ValueFromName(%q) = %v, %v, want %v, nil`, value.String(), named, err, value)
+		}
+
+		card.Code = ""
+		card.ComputeCode()
+		if card.Code != code {
+			t.Fatalf(`ComputeCode() of %v = %q, want %q`, card, card.Code, code)
+		}
+	}
+	if len(seen) != 54 {
+		t.Fatalf(`%d cards have codes, want 54`, len(seen))
+	}
+}
+
+// Test_CodeToSuitValue_Canonical checks any code that parses, whatever its
+// case or spelling of ten, parses to the same card as its canonical code.
+func Test_CodeToSuitValue_Canonical(t *testing.T) {
+	property := func(value_part string, suit_part string) bool {
+		code := value_part + suit_part
+		suit, value, err := CodeToSuitValue(code)
+		if err != nil {
+			return true
+		}
+		canonical := CardCode(*suit, *value)
+		canonical_suit, canonical_value, err := CodeToSuitValue(canonical)
+		return err == nil && *canonical_suit == *suit && *canonical_value == *value &&
+			(canonical == strings.ToUpper(code) || *value == Ten)
+	}
+	values := []string{"A", "a", "2", "9", "10", "0", "T", "t", "J", "q", "K", "1", "11", "X", ""}
+	suits := []string{"S", "c", "H", "d", "1", "2", "X", "B", ""}
+	for _, value_part := range values {
+		for _, suit_part := range suits {
+			if !property(value_part, suit_part) {
+				t.Fatalf(`CodeToSuitValue(%q) doesn't match its canonical code`, value_part+suit_part)
+			}
+		}
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ToValue_Ten(t *testing.T) {
+	for _, code := range []string{"10", "0", "T", "t"} {
+		if value, err := ToValue(code); err != nil || value != Ten {
+			t.Fatalf(`ToValue(%q) = %v, %v, want %v, nil`, code, value, err, Ten)
+		}
+	}
+	for _, code := range []string{"1", "11", "01", "B"} {
+		if _, err := ToValue(code); err == nil {
+			t.Fatalf(`ToValue(%q) = _, nil, want error`, code)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"sort"
+)
+
+// Contains the logic for comparing and sorting cards
+
+// An Ordering ranks cards by value, with aces high or low, and breaks ties
+// between equal values by the precedence of their suits
+type Ordering struct {
+	Name    string
+	AceHigh bool
+	// the suits from lowest to highest, empty when suits don't rank
+	Suits []Suit
+}
+
+// Poker ranks aces high and doesn't rank suits
+var POKER_ORDERING = Ordering{Name: "poker", AceHigh: true}
+
+// Ace low ranks aces below twos and doesn't rank suits
+var ACE_LOW_ORDERING = Ordering{Name: "ace_low", AceHigh: false}
+
+// Bridge ranks aces high and clubs, diamonds, hearts then spades
+var BRIDGE_ORDERING = Ordering{Name: "bridge", AceHigh: true, Suits: []Suit{Clubs, Diamonds, Hearts, Spades}}
+
+var orderings = map[string]Ordering{
+	POKER_ORDERING.Name:   POKER_ORDERING,
+	ACE_LOW_ORDERING.Name: ACE_LOW_ORDERING,
+	BRIDGE_ORDERING.Name:  BRIDGE_ORDERING,
+}
+
+// GetOrdering returns the ordering with the given name.
+func GetOrdering(name string) (Ordering, bool) {
+	ordering, ok := orderings[name]
+	return ordering, ok
+}
+
+// OrderingNames returns the names of all the orderings in order.
+func OrderingNames() []string {
+	var names []string
+	for name := range orderings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rank returns the rank of the value, from 1 for a low ace up to 14 for a
+// high ace. Jokers rank above every other card.
+func (ordering Ordering) Rank(value Value) int {
+	switch value {
+	case Ace:
+		if ordering.AceHigh {
+			return 14
+		}
+		return 1
+	case Joker:
+		return 15
+	}
+	return int(value)
+}
+
+// suitRank returns the precedence of the suit, which is 0 for every suit
+// when suits don't rank.
+func (ordering Ordering) suitRank(suit Suit) int {
+	for i, ranked := range ordering.Suits {
+		if ranked == suit {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Compare returns -1 when a ranks below b, 1 when it ranks above and 0 when
+// they rank the same.
+func (ordering Ordering) Compare(a Card, b Card) int {
+	a_rank, b_rank := ordering.Rank(a.Value), ordering.Rank(b.Value)
+	if a_rank == b_rank {
+		a_rank, b_rank = ordering.suitRank(a.Suit), ordering.suitRank(b.Suit)
+	}
+	if a_rank < b_rank {
+		return -1
+	} else if a_rank > b_rank {
+		return 1
+	}
+	return 0
+}
+
+// Compare compares the card to the other card using the ordering.
+func (card Card) Compare(other Card, ordering Ordering) int {
+	return ordering.Compare(card, other)
+}
+
+// Beats returns whether the card ranks above the other card.
+func (card Card) Beats(other Card, ordering Ordering) bool {
+	return ordering.Compare(card, other) > 0
+}
+
+// SortCards sorts the cards from lowest to highest, keeping the order of
+// cards that rank the same.
+func SortCards(cards []Card, ordering Ordering) {
+	sort.SliceStable(cards, func(i, j int) bool {
+		return ordering.Compare(cards[i], cards[j]) < 0
+	})
+}
+
+// SortCardsBySuit groups the cards by suit, following the ordering's suit
+// precedence or else the order of the suits, with each suit sorted from
+// lowest to highest.
+func SortCardsBySuit(cards []Card, ordering Ordering) {
+	suit_rank := func(suit Suit) int {
+		if len(ordering.Suits) > 0 {
+			return ordering.suitRank(suit)
+		}
+		return int(suit)
+	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		if cards[i].Suit != cards[j].Suit {
+			return suit_rank(cards[i].Suit) < suit_rank(cards[j].Suit)
+		}
+		return ordering.Rank(cards[i].Value) < ordering.Rank(cards[j].Value)
+	})
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cardsFromCodes parses the card codes.
+func cardsFromCodes(t *testing.T, codes ...string) []Card {
+	var cards []Card
+	for _, code := range codes {
+		suit, value, err := CodeToSuitValue(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cards = append(cards, NewCard(*suit, *value))
+	}
+	return cards
+}
+
+// cardCodes returns the codes of the cards.
+func cardCodes(cards []Card) []string {
+	var codes []string
+	for _, card := range cards {
+		codes = append(codes, CardCode(card.Suit, card.Value))
+	}
+	return codes
+}
+
+func Test_Ordering_Compare(t *testing.T) {
+	for _, test := range []struct {
+		ordering Ordering
+		a, b     string
+		expected int
+	}{
+		{POKER_ORDERING, "KH", "10H", 1},
+		{POKER_ORDERING, "AS", "KS", 1},
+		{POKER_ORDERING, "2C", "3C", -1},
+		{POKER_ORDERING, "QS", "QH", 0},
+		{ACE_LOW_ORDERING, "AS", "2S", -1},
+		{ACE_LOW_ORDERING, "AS", "AH", 0},
+		{BRIDGE_ORDERING, "QS", "QH", 1},
+		{BRIDGE_ORDERING, "2D", "2C", 1},
+		{BRIDGE_ORDERING, "KC", "QS", 1},
+		{POKER_ORDERING, "X1", "AS", 1},
+	} {
+		cards := cardsFromCodes(t, test.a, test.b)
+		assert.Equal(t, test.expected, cards[0].Compare(cards[1], test.ordering), "%s %s %s", test.ordering.Name, test.a, test.b)
+		assert.Equal(t, -test.expected, test.ordering.Compare(cards[1], cards[0]), "%s %s %s", test.ordering.Name, test.b, test.a)
+		assert.Equal(t, test.expected > 0, cards[0].Beats(cards[1], test.ordering))
+	}
+}
+
+func Test_SortCards(t *testing.T) {
+	cards := cardsFromCodes(t, "KH", "AS", "10H", "2C", "QD", "QS")
+	SortCards(cards, POKER_ORDERING)
+	// cards of the same rank keep their order
+	assert.Equal(t, []string{"2C", "10H", "QD", "QS", "KH", "AS"}, cardCodes(cards))
+
+	SortCards(cards, ACE_LOW_ORDERING)
+	assert.Equal(t, []string{"AS", "2C", "10H", "QD", "QS", "KH"}, cardCodes(cards))
+
+	SortCards(cards, BRIDGE_ORDERING)
+	assert.Equal(t, []string{"2C", "10H", "QD", "QS", "KH", "AS"}, cardCodes(cards))
+}
+
+func Test_SortCardsBySuit(t *testing.T) {
+	cards := cardsFromCodes(t, "KH", "AS", "10H", "2C", "QD", "QS")
+	SortCardsBySuit(cards, BRIDGE_ORDERING)
+	assert.Equal(t, []string{"2C", "QD", "10H", "KH", "QS", "AS"}, cardCodes(cards))
+
+	SortCardsBySuit(cards, ACE_LOW_ORDERING)
+	assert.Equal(t, []string{"AS", "QS", "2C", "10H", "KH", "QD"}, cardCodes(cards))
+}
+
+func Test_GetOrdering(t *testing.T) {
+	ordering, ok := GetOrdering("bridge")
+	assert.True(t, ok)
+	assert.Equal(t, BRIDGE_ORDERING, ordering)
+	_, ok = GetOrdering("canasta")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"ace_low", "bridge", "poker"}, OrderingNames())
+}
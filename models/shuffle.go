@@ -0,0 +1,93 @@
+package models
+
+import (
+	crypto_rand "crypto/rand"
+	"encoding/binary"
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+)
+
+// Contains the logic for shuffling the cards of a deck
+
+// Decks in the standard mode are shuffled with math/rand, from their seed
+// when they have one.
+const STANDARD_SHUFFLE = "standard"
+
+// Decks in the secure mode are always shuffled with crypto/rand and commit to
+// their initial order when they are created.
+const SECURE_SHUFFLE = "secure"
+
+// Shuffle puts the cards of the deck in a new order and records the shuffle
+// on the deck.
+type Shuffle func(deck *Deck, cards []Card)
+
+// cryptoSource is a math/rand source that reads from crypto/rand, used for
+// decks that weren't given a seed.
+type cryptoSource struct{}
+
+func (cryptoSource) Uint64() uint64 {
+	var buffer [8]byte
+	if _, err := crypto_rand.Read(buffer[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint64(buffer[:])
+}
+
+func (s cryptoSource) Int63() int64 {
+	return int64(s.Uint64() & (1<<63 - 1))
+}
+
+func (cryptoSource) Seed(int64) {}
+
+// deckRand returns the random number generator for the next shuffle of the
+// deck. Every shuffle of a seeded deck gets its own source derived from the
+// seed and the number of times the deck was shuffled before, so replaying
+// the same calls with the same seed gives the same orders.
+func deckRand(deck *Deck) *rand.Rand {
+	if deck.Seed == nil {
+		return rand.New(cryptoSource{})
+	}
+	hash := fnv.New64a()
+	binary.Write(hash, binary.BigEndian, *deck.Seed)
+	binary.Write(hash, binary.BigEndian, int64(deck.Shuffles))
+	return rand.New(rand.NewSource(int64(hash.Sum64())))
+}
+
+// DeckRand returns the random number generator for a random draw from, or
+// insert into, the deck and records it on the deck like a shuffle, so
+// replaying the same calls on a seeded deck gives the same cards. Secure
+// decks always use crypto/rand.
+func DeckRand(deck *Deck) *rand.Rand {
+	random := deckRand(deck)
+	if deck.ShuffleMode == SECURE_SHUFFLE {
+		random = rand.New(cryptoSource{})
+	}
+	deck.Shuffles++
+	return random
+}
+
+// secureShuffle is a Fisher-Yates shuffle where every swap is picked
+// uniformly by crypto/rand.
+func secureShuffle(cards []Card) {
+	for i := len(cards) - 1; i > 0; i-- {
+		j, err := crypto_rand.Int(crypto_rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			panic(err)
+		}
+		cards[i], cards[j.Int64()] = cards[j.Int64()], cards[i]
+	}
+}
+
+// ShuffleCards puts the cards in a random order using the deck's shuffle
+// mode and random number generator.
+func ShuffleCards(deck *Deck, cards []Card) {
+	if deck.ShuffleMode == SECURE_SHUFFLE {
+		secureShuffle(cards)
+	} else {
+		deckRand(deck).Shuffle(len(cards), func(i, j int) {
+			cards[i], cards[j] = cards[j], cards[i]
+		})
+	}
+	deck.Shuffles++
+}
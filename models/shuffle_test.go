@@ -0,0 +1,98 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shuffleTestCards() []Card {
+	var cards []Card
+	for _, suit := range []Suit{Spades, Clubs, Hearts, Diamonds} {
+		for _, value := range []Value{Ace, Two, Three, Four, Five, Six, Seven, Eight, Nine, Ten, Jack, Queen, King} {
+			cards = append(cards, Card{Suit: suit, Value: value})
+		}
+	}
+	return cards
+}
+
+func Test_ShuffleCards_Seeded(t *testing.T) {
+	seed := int64(42)
+	first_deck, second_deck := Deck{Seed: &seed}, Deck{Seed: &seed}
+	first, second := shuffleTestCards(), shuffleTestCards()
+
+	ShuffleCards(&first_deck, first)
+	ShuffleCards(&second_deck, second)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, shuffleTestCards(), first)
+	assert.EqualValues(t, 1, first_deck.Shuffles)
+
+	// the next shuffle of the same deck gives a different order
+	reshuffled := shuffleTestCards()
+	ShuffleCards(&first_deck, reshuffled)
+	assert.NotEqual(t, first, reshuffled)
+	assert.EqualValues(t, 2, first_deck.Shuffles)
+
+	other_seed := int64(43)
+	other := shuffleTestCards()
+	ShuffleCards(&Deck{Seed: &other_seed}, other)
+	assert.NotEqual(t, first, other)
+}
+
+func Test_ShuffleCards_Unseeded(t *testing.T) {
+	deck := Deck{}
+	cards := shuffleTestCards()
+	ShuffleCards(&deck, cards)
+	assert.ElementsMatch(t, shuffleTestCards(), cards)
+	assert.EqualValues(t, 1, deck.Shuffles)
+}
+
+func Test_ShuffleCards_Secure(t *testing.T) {
+	seed := int64(42)
+	// the seed is ignored by secure decks
+	first_deck, second_deck := Deck{Seed: &seed, ShuffleMode: SECURE_SHUFFLE}, Deck{Seed: &seed, ShuffleMode: SECURE_SHUFFLE}
+	first, second := shuffleTestCards(), shuffleTestCards()
+
+	ShuffleCards(&first_deck, first)
+	ShuffleCards(&second_deck, second)
+	assert.NotEqual(t, first, second)
+	assert.ElementsMatch(t, shuffleTestCards(), first)
+	assert.EqualValues(t, 1, first_deck.Shuffles)
+}
+
+func Test_DeckRand(t *testing.T) {
+	seed := int64(42)
+	first_deck, second_deck := Deck{Seed: &seed}, Deck{Seed: &seed}
+	assert.Equal(t, DeckRand(&first_deck).Perm(52), DeckRand(&second_deck).Perm(52))
+	assert.EqualValues(t, 1, first_deck.Shuffles)
+	assert.NotEqual(t, DeckRand(&first_deck).Perm(52), DeckRand(&Deck{Seed: &seed}).Perm(52))
+
+	// the seed is ignored by secure decks
+	secure_deck, other_deck := Deck{Seed: &seed, ShuffleMode: SECURE_SHUFFLE}, Deck{Seed: &seed, ShuffleMode: SECURE_SHUFFLE}
+	assert.NotEqual(t, DeckRand(&secure_deck).Perm(52), DeckRand(&other_deck).Perm(52))
+	assert.EqualValues(t, 1, secure_deck.Shuffles)
+}
+
+// Test_secureShuffle checks every card ends up in every position about as
+// often as any other.
+func Test_secureShuffle(t *testing.T) {
+	const ROUNDS = 20000
+	cards := []Card{{Value: Ace}, {Value: Two}, {Value: Three}, {Value: Four}}
+	counts := map[Value][]int{}
+	for _, card := range cards {
+		counts[card.Value] = make([]int, len(cards))
+	}
+	for i := 0; i < ROUNDS; i++ {
+		shuffled := append([]Card(nil), cards...)
+		secureShuffle(shuffled)
+		for position, card := range shuffled {
+			counts[card.Value][position]++
+		}
+	}
+	expected := ROUNDS / len(cards)
+	for value, positions := range counts {
+		for position, count := range positions {
+			assert.InDelta(t, expected, count, float64(expected)/10, "card %s in position %d", value, position)
+		}
+	}
+}
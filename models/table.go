@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+)
+
+// The states of a blackjack table: no round has been dealt yet, a round is
+// being played, or the last round is over and settled
+const TABLE_WAITING = "waiting"
+const TABLE_PLAYING = "playing"
+const TABLE_FINISHED = "finished"
+
+// A hand played at a blackjack table, by the player in the seat or the dealer
+type TableHand struct {
+	Seat  int    `json:"seat,omitempty"`
+	Cards []Card `json:"cards"`
+	Bet   int    `json:"bet,omitempty"`
+	// whether the hand came from a split, which can't make a blackjack
+	Split    bool    `json:"split,omitempty"`
+	Doubled  bool    `json:"doubled,omitempty"`
+	Finished bool    `json:"finished"`
+	Outcome  string  `json:"outcome,omitempty"`
+	Payout   float64 `json:"payout"`
+}
+
+// A blackjack table dealing from a shoe, which is a deck of the DeckStore
+type Table struct {
+	Id     string `gorm:"primaryKey" json:"table_id"`
+	DeckId string `json:"-"`
+	Seats  int    `json:"seats"`
+	// whether the dealer hits a soft 17 rather than standing on it
+	HitSoft17 bool   `json:"hit_soft_17"`
+	Status    string `json:"status"`
+	// the index of the hand being played
+	Turn      int         `json:"turn"`
+	Hands     []TableHand `gorm:"serializer:json" json:"hands"`
+	Dealer    TableHand   `gorm:"serializer:json" json:"dealer"`
+	Version   int         `json:"-" gorm:"not null;default:0"`
+	CreatedAt time.Time   `json:"-"`
+	UpdatedAt time.Time   `json:"-"`
+}
+
+// CardsOnTable returns how many cards are held by the hands and the dealer.
+func (table *Table) CardsOnTable() int {
+	count := len(table.Dealer.Cards)
+	for _, hand := range table.Hands {
+		count += len(hand.Cards)
+	}
+	return count
+}
+
+// Draw takes up to count cards from the top of a table's shoe.
+type Draw func(count int) ([]Card, error)
+
+// Play changes the table, drawing the cards it needs from the table's shoe.
+type Play func(table *Table, draw Draw) error
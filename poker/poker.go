@@ -0,0 +1,202 @@
+package poker
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the poker hand evaluator. A hand of 5 to 7 cards is scored by the
+// best five cards it holds, using a bit mask of the ranks in every suit so no
+// combinations of cards have to be tried.
+
+const MIN_CARDS = 5
+const MAX_CARDS = 7
+
+type Category int
+
+const (
+	HIGH_CARD Category = iota
+	PAIR
+	TWO_PAIR
+	THREE_OF_A_KIND
+	STRAIGHT
+	FLUSH
+	FULL_HOUSE
+	FOUR_OF_A_KIND
+	STRAIGHT_FLUSH
+	ROYAL_FLUSH
+)
+
+func (category Category) String() string {
+	names := []string{"high_card", "pair", "two_pair", "three_of_a_kind", "straight", "flush",
+		"full_house", "four_of_a_kind", "straight_flush", "royal_flush"}
+	if category < 0 || int(category) >= len(names) {
+		return "unknown"
+	}
+	return names[category]
+}
+
+// A Hand is the category of the best five cards along with a rank that
+// orders every hand: the higher rank wins and equal ranks split the pot.
+type Hand struct {
+	Category Category
+	Rank     uint32
+}
+
+var ErrInvalidHand = errors.New("invalid hand")
+
+// the rank of aces, which also count as 1 in the lowest straight
+const ACE_RANK = 14
+
+// rank returns the poker rank of the value, from 2 up to 14 for an ace, or 0
+// for values poker doesn't have.
+func rank(value models.Value) uint {
+	switch {
+	case value == models.Ace:
+		return ACE_RANK
+	case value >= models.Two && value <= models.King:
+		return uint(value)
+	}
+	return 0
+}
+
+// newHand encodes the category followed by up to five ranks, most
+// significant first, into a hand.
+func newHand(category Category, ranks ...uint) Hand {
+	score := uint32(category)
+	for i := 0; i < 5; i++ {
+		score <<= 4
+		if i < len(ranks) {
+			score |= uint32(ranks[i])
+		}
+	}
+	return Hand{Category: category, Rank: score}
+}
+
+// straightHigh returns the highest card of the best straight in the mask of
+// ranks, or 0 when there is no straight.
+func straightHigh(mask uint16) uint {
+	if mask&(1<<ACE_RANK) != 0 {
+		mask |= 1 << 1
+	}
+	for high := uint(ACE_RANK); high >= 5; high-- {
+		straight := uint16(0x1F) << (high - 4)
+		if mask&straight == straight {
+			return high
+		}
+	}
+	return 0
+}
+
+// topRanks fills ranks with the highest ranks in the mask, returning the
+// ranks that were filled.
+func topRanks(mask uint16, ranks []uint) []uint {
+	for i := range ranks {
+		if mask == 0 {
+			return ranks[:i]
+		}
+		high := uint(bits.Len16(mask) - 1)
+		ranks[i] = high
+		mask &^= 1 << high
+	}
+	return ranks
+}
+
+// Evaluate scores the best five card poker hand among 5 to 7 cards. Jokers
+// and repeated cards aren't allowed.
+func Evaluate(cards []models.Card) (Hand, error) {
+	if len(cards) < MIN_CARDS || len(cards) > MAX_CARDS {
+		return Hand{}, fmt.Errorf("%w: %d cards, must be between %d and %d", ErrInvalidHand, len(cards), MIN_CARDS, MAX_CARDS)
+	}
+	var suits [4]uint16
+	var counts [ACE_RANK + 1]uint8
+	var ranks [5]uint
+	for _, card := range cards {
+		card_rank := rank(card.Value)
+		if card_rank == 0 || card.Suit < models.Spades || card.Suit > models.Diamonds {
+			return Hand{}, fmt.Errorf("%w: %s can't be played", ErrInvalidHand, models.CardCode(card.Suit, card.Value))
+		}
+		bit := uint16(1) << card_rank
+		if suits[card.Suit]&bit != 0 {
+			return Hand{}, fmt.Errorf("%w: %s is repeated", ErrInvalidHand, models.CardCode(card.Suit, card.Value))
+		}
+		suits[card.Suit] |= bit
+		counts[card_rank]++
+	}
+
+	// with at most seven cards a flush rules out four of a kind and a full
+	// house, so it is checked first
+	for _, mask := range suits {
+		if bits.OnesCount16(mask) >= 5 {
+			if high := straightHigh(mask); high == ACE_RANK {
+				return newHand(ROYAL_FLUSH, high), nil
+			} else if high > 0 {
+				return newHand(STRAIGHT_FLUSH, high), nil
+			}
+			return newHand(FLUSH, topRanks(mask, ranks[:5])...), nil
+		}
+	}
+
+	all := suits[0] | suits[1] | suits[2] | suits[3]
+	var quads, trips, first_pair, second_pair uint
+	for card_rank := uint(ACE_RANK); card_rank >= 2; card_rank-- {
+		switch counts[card_rank] {
+		case 4:
+			quads = card_rank
+		case 3:
+			if trips == 0 {
+				trips = card_rank
+			} else if first_pair == 0 {
+				// a second three of a kind can only make the pair of a
+				// full house
+				first_pair = card_rank
+			}
+		case 2:
+			if first_pair == 0 {
+				first_pair = card_rank
+			} else if second_pair == 0 {
+				second_pair = card_rank
+			}
+		}
+	}
+	switch {
+	case quads > 0:
+		ranks[0] = quads
+		topRanks(all&^(1<<quads), ranks[1:2])
+		return newHand(FOUR_OF_A_KIND, ranks[:2]...), nil
+	case trips > 0 && first_pair > 0:
+		return newHand(FULL_HOUSE, trips, first_pair), nil
+	}
+	if high := straightHigh(all); high > 0 {
+		return newHand(STRAIGHT, high), nil
+	}
+	switch {
+	case trips > 0:
+		ranks[0] = trips
+		topRanks(all&^(1<<trips), ranks[1:3])
+		return newHand(THREE_OF_A_KIND, ranks[:3]...), nil
+	case second_pair > 0:
+		ranks[0], ranks[1] = first_pair, second_pair
+		topRanks(all&^(1<<first_pair)&^(1<<second_pair), ranks[2:3])
+		return newHand(TWO_PAIR, ranks[:3]...), nil
+	case first_pair > 0:
+		ranks[0] = first_pair
+		topRanks(all&^(1<<first_pair), ranks[1:4])
+		return newHand(PAIR, ranks[:4]...), nil
+	}
+	return newHand(HIGH_CARD, topRanks(all, ranks[:5])...), nil
+}
+
+// Compare returns -1 when hand a loses to hand b, 1 when it wins and 0 when
+// they split the pot.
+func Compare(a Hand, b Hand) int {
+	if a.Rank < b.Rank {
+		return -1
+	} else if a.Rank > b.Rank {
+		return 1
+	}
+	return 0
+}
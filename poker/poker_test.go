@@ -0,0 +1,210 @@
+package poker
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/b055/cards/models"
+)
+
+// hand parses the card codes.
+func hand(t testing.TB, codes ...string) []models.Card {
+	var cards []models.Card
+	for _, code := range codes {
+		suit, value, err := models.CodeToSuitValue(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cards = append(cards, models.NewCard(*suit, *value))
+	}
+	return cards
+}
+
+// fullDeck returns the 52 cards poker is played with.
+func fullDeck() []models.Card {
+	deck_type, _ := models.GetDeckType(models.STANDARD_DECK)
+	return deck_type.Cards()
+}
+
+func Test_Evaluate_Categories(t *testing.T) {
+	for _, test := range []struct {
+		codes    []string
+		expected Category
+	}{
+		{[]string{"AS", "KS", "QS", "JS", "10S"}, ROYAL_FLUSH},
+		{[]string{"9H", "KH", "QH", "JH", "10H", "2C", "2D"}, STRAIGHT_FLUSH},
+		{[]string{"AD", "2D", "3D", "4D", "5D"}, STRAIGHT_FLUSH},
+		{[]string{"7S", "7H", "7D", "7C", "2D", "2C"}, FOUR_OF_A_KIND},
+		{[]string{"7S", "7H", "7D", "2C", "2D", "KS"}, FULL_HOUSE},
+		{[]string{"7S", "7H", "7D", "2C", "2D", "2S", "KS"}, FULL_HOUSE},
+		{[]string{"2H", "7H", "9H", "JH", "KH", "KS", "KD"}, FLUSH},
+		{[]string{"AS", "2D", "3C", "4H", "5S", "KD"}, STRAIGHT},
+		{[]string{"10S", "JD", "QC", "KH", "AS"}, STRAIGHT},
+		{[]string{"7S", "7H", "7D", "2C", "KS"}, THREE_OF_A_KIND},
+		{[]string{"7S", "7H", "2D", "2C", "KS", "KH", "AS"}, TWO_PAIR},
+		{[]string{"7S", "7H", "2D", "3C", "KS"}, PAIR},
+		{[]string{"7S", "9H", "2D", "3C", "KS", "QD", "JH"}, HIGH_CARD},
+	} {
+		result, err := Evaluate(hand(t, test.codes...))
+		assert.NoError(t, err, test.codes)
+		assert.Equal(t, test.expected, result.Category, test.codes)
+	}
+}
+
+func Test_Evaluate_Kickers(t *testing.T) {
+	for _, test := range []struct {
+		winner, loser []string
+	}{
+		// the better kicker wins
+		{[]string{"AS", "AH", "KD", "7C", "3S"}, []string{"AC", "AD", "QD", "JC", "9S"}},
+		// the wheel is the lowest straight
+		{[]string{"2S", "3H", "4D", "5C", "6S"}, []string{"AS", "2H", "3D", "4C", "5S"}},
+		// two pair compares the high pair, then the low pair, then the kicker
+		{[]string{"KS", "KH", "3D", "3C", "2S"}, []string{"QS", "QH", "JD", "JC", "AS"}},
+		{[]string{"KS", "KH", "3D", "3C", "5S"}, []string{"KC", "KD", "3S", "3H", "4S"}},
+		// the third pair of seven cards can be the kicker
+		{[]string{"KS", "KH", "QD", "QC", "JS", "JH", "2C"}, []string{"KC", "KD", "QS", "QH", "10S", "10H", "9C"}},
+		// the full house with the higher three of a kind wins
+		{[]string{"3S", "3H", "3D", "2C", "2S"}, []string{"2H", "2D", "2C", "AS", "AH"}},
+		// a flush compares all five cards
+		{[]string{"AH", "JH", "9H", "6H", "3H"}, []string{"AS", "JS", "9S", "6S", "2S"}},
+	} {
+		winner, err := Evaluate(hand(t, test.winner...))
+		assert.NoError(t, err)
+		loser, err := Evaluate(hand(t, test.loser...))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, Compare(winner, loser), "%v beats %v", test.winner, test.loser)
+		assert.Equal(t, -1, Compare(loser, winner))
+	}
+
+	// suits don't break ties
+	first, _ := Evaluate(hand(t, "AS", "KS", "9D", "7C", "3S"))
+	second, _ := Evaluate(hand(t, "AH", "KH", "9C", "7D", "3H"))
+	assert.Equal(t, 0, Compare(first, second))
+}
+
+func Test_Evaluate_Invalid(t *testing.T) {
+	for _, codes := range [][]string{
+		{"AS", "KS", "QS", "JS"},
+		{"AS", "KS", "QS", "JS", "10S", "9S", "8S", "7S"},
+		{"AS", "KS", "QS", "JS", "X1"},
+		{"AS", "KS", "QS", "JS", "AS"},
+	} {
+		_, err := Evaluate(hand(t, codes...))
+		assert.True(t, errors.Is(err, ErrInvalidHand), codes)
+	}
+}
+
+// Test_Evaluate_AllFiveCardHands checks every five card hand falls into the
+// category as often as it should, and that there are 7462 distinct ranks.
+func Test_Evaluate_AllFiveCardHands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("evaluates every five card hand")
+	}
+	deck := fullDeck()
+	counts := map[Category]int{}
+	ranks := map[uint32]bool{}
+	cards := make([]models.Card, 5)
+	for a := 0; a < len(deck); a++ {
+		for b := a + 1; b < len(deck); b++ {
+			for c := b + 1; c < len(deck); c++ {
+				for d := c + 1; d < len(deck); d++ {
+					for e := d + 1; e < len(deck); e++ {
+						cards[0], cards[1], cards[2], cards[3], cards[4] = deck[a], deck[b], deck[c], deck[d], deck[e]
+						result, err := Evaluate(cards)
+						if err != nil {
+							t.Fatal(err)
+						}
+						counts[result.Category]++
+						ranks[result.Rank] = true
+					}
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[Category]int{
+		HIGH_CARD:       1302540,
+		PAIR:            1098240,
+		TWO_PAIR:        123552,
+		THREE_OF_A_KIND: 54912,
+		STRAIGHT:        10200,
+		FLUSH:           5108,
+		FULL_HOUSE:      3744,
+		FOUR_OF_A_KIND:  624,
+		STRAIGHT_FLUSH:  36,
+		ROYAL_FLUSH:     4,
+	}, counts)
+	assert.Len(t, ranks, 7462)
+}
+
+// Test_Evaluate_BestFive checks seven card hands score the same as the best
+// five cards among them.
+func Test_Evaluate_BestFive(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	deck := fullDeck()
+	for round := 0; round < 2000; round++ {
+		random.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+		cards := deck[:7]
+		result, err := Evaluate(cards)
+		assert.NoError(t, err)
+
+		var best Hand
+		for skip_first := 0; skip_first < 7; skip_first++ {
+			for skip_second := skip_first + 1; skip_second < 7; skip_second++ {
+				var five []models.Card
+				for i, card := range cards {
+					if i != skip_first && i != skip_second {
+						five = append(five, card)
+					}
+				}
+				if five_result, _ := Evaluate(five); five_result.Rank > best.Rank {
+					best = five_result
+				}
+			}
+		}
+		assert.Equal(t, best, result)
+	}
+}
+
+func Test_Category_String(t *testing.T) {
+	assert.Equal(t, "full_house", FULL_HOUSE.String())
+	assert.Equal(t, "royal_flush", ROYAL_FLUSH.String())
+	assert.Equal(t, "unknown", Category(10).String())
+}
+
+func BenchmarkEvaluate_SevenCards(b *testing.B) {
+	random := rand.New(rand.NewSource(1))
+	deck := fullDeck()
+	hands := make([][]models.Card, 1024)
+	for i := range hands {
+		random.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+		hands[i] = append([]models.Card(nil), deck[:7]...)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Evaluate(hands[i%len(hands)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvaluate_FiveCards(b *testing.B) {
+	random := rand.New(rand.NewSource(1))
+	deck := fullDeck()
+	hands := make([][]models.Card, 1024)
+	for i := range hands {
+		random.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+		hands[i] = append([]models.Card(nil), deck[:5]...)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Evaluate(hands[i%len(hands)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the logic for choosing which cards of a pile are drawn
+
+const FROM_TOP = "top"
+const FROM_BOTTOM = "bottom"
+const FROM_RANDOM = "random"
+
+// How a draw of more cards than the pile holds is handled
+const DRAW_PARTIAL = "partial"
+const DRAW_STRICT = "strict"
+
+// DrawOptions describes which cards to draw from a pile. When Codes is set
+// exactly those cards are drawn, otherwise up to Count cards are drawn From
+// the top, the bottom or random positions of the pile. In the strict Mode
+// nothing is drawn unless all Count cards are there.
+type DrawOptions struct {
+	Count int
+	From  string
+	Codes []string
+	Mode  string
+}
+
+// selectCards returns the indexes of the cards to draw from the pile of the
+// deck, which is ordered from the top down, in the order they are drawn.
+// Random draws use the deck's random number generator and are recorded on the
+// deck.
+func selectCards(deck *models.Deck, cards []models.Card, options DrawOptions) ([]int, error) {
+	if len(options.Codes) > 0 {
+		return selectCodes(cards, options.Codes)
+	}
+	if err := checkEnoughCards(len(cards), options); err != nil {
+		return nil, err
+	}
+
+	count := options.Count
+	if count > len(cards) {
+		count = len(cards)
+	}
+	if count < 0 {
+		count = 0
+	}
+	selected := make([]int, count)
+	switch options.From {
+	case FROM_BOTTOM:
+		for i := 0; i < count; i++ {
+			selected[i] = len(cards) - 1 - i
+		}
+	case FROM_RANDOM:
+		copy(selected, models.DeckRand(deck).Perm(len(cards)))
+	default:
+		for i := 0; i < count; i++ {
+			selected[i] = i
+		}
+	}
+	return selected, nil
+}
+
+// selectCodes finds a card for every code, failing with ErrCardNotFound when
+// the pile doesn't hold it. A code given twice needs two matching cards.
+func selectCodes(cards []models.Card, codes []string) ([]int, error) {
+	taken := make([]bool, len(cards))
+	selected := make([]int, 0, len(codes))
+	for _, code := range codes {
+		suit, value, err := models.CodeToSuitValue(code)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i := 0; i < len(cards); i++ {
+			if !taken[i] && cards[i].Suit == *suit && cards[i].Value == *value {
+				taken[i] = true
+				selected = append(selected, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrCardNotFound, code)
+		}
+	}
+	return selected, nil
+}
+
+// checkEnoughCards fails with ErrNoCardsLeft when cards are asked for but the
+// pile holding them is empty, and in the strict mode with ErrNotEnoughCards
+// when fewer than the count are available.
+func checkEnoughCards(available int, options DrawOptions) error {
+	if len(options.Codes) > 0 || options.Count <= 0 {
+		return nil
+	}
+	if available == 0 {
+		return ErrNoCardsLeft
+	}
+	if options.Mode == DRAW_STRICT && available < options.Count {
+		return fmt.Errorf("%w: %d of %d", ErrNotEnoughCards, available, options.Count)
+	}
+	return nil
+}
@@ -0,0 +1,851 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the DeckStore backed by a GORM database
+
+// The number of times a transaction that lost a race with another one is
+// attempted before giving up.
+const MAX_ATTEMPTS = 10
+
+// errConflict is returned from within a transaction when another transaction
+// modified the deck in the meantime.
+var errConflict = errors.New("deck was modified concurrently")
+
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// retry runs the transaction again when it conflicted with another one or the
+// database was too busy to run it.
+func (s *GormStore) retry(transaction func() error) error {
+	var err error
+	for attempt := 1; attempt <= MAX_ATTEMPTS; attempt++ {
+		if err = transaction(); err == nil || !isRetryable(err) {
+			return err
+		}
+		log.Warnf("Retrying transaction, attempt %d: %s", attempt, err)
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, errConflict) {
+		return true
+	}
+	var sqlite_err sqlite3.Error
+	if errors.As(err, &sqlite_err) {
+		return sqlite_err.Code == sqlite3.ErrBusy || sqlite_err.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// lockDeck reads the deck within the transaction, holding a row lock on it
+// where the database supports it.
+func lockDeck(tx *gorm.DB, deck_id string) (*models.Deck, error) {
+	query := tx
+	if tx.Dialector.Name() == models.POSTGRES_DRIVER {
+		query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var deck models.Deck
+	if result := query.First(&deck, "id = ?", deck_id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrDeckNotFound
+		}
+		return nil, result.Error
+	}
+	return &deck, nil
+}
+
+// pileCards returns up to limit cards of the pile from the top down. A
+// negative limit returns the whole pile.
+func pileCards(tx *gorm.DB, deck_id string, pile string, limit int) ([]models.Card, error) {
+	cards := []models.Card{}
+	result := tx.Where("deck_id = ? AND pile = ?", deck_id, pile).Order("position").Limit(limit).Find(&cards)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return cards, nil
+}
+
+// topPosition returns the position of a card placed on top of the pile.
+func topPosition(tx *gorm.DB, deck_id string, pile string) (int, error) {
+	var position sql.NullInt64
+	row := tx.Model(&models.Card{}).Where("deck_id = ? AND pile = ?", deck_id, pile).Select("MIN(position)").Row()
+	if err := row.Scan(&position); err != nil {
+		return 0, err
+	}
+	if !position.Valid {
+		return 0, nil
+	}
+	return int(position.Int64) - 1, nil
+}
+
+// bottomPosition returns the position of the card at the bottom of the
+// pile, or -1 when the pile is empty.
+func bottomPosition(tx *gorm.DB, deck_id string, pile string) (int, error) {
+	var position sql.NullInt64
+	row := tx.Model(&models.Card{}).Where("deck_id = ? AND pile = ?", deck_id, pile).Select("MAX(position)").Row()
+	if err := row.Scan(&position); err != nil {
+		return 0, err
+	}
+	if !position.Valid {
+		return -1, nil
+	}
+	return int(position.Int64), nil
+}
+
+// moveCard puts the card at the given position of the pile. It fails with
+// errConflict when the card was moved out of its pile in the meantime.
+func moveCard(tx *gorm.DB, card *models.Card, pile string, position int, drawn_at *time.Time) error {
+	result := tx.Model(&models.Card{}).Where("id = ? AND pile = ?", card.Id, card.Pile).
+		Updates(map[string]any{"pile": pile, "position": position, "drawn_at": drawn_at, "updated_at": time.Now()})
+	if result.Error != nil {
+		log.Errorf("Failed to move card %v to pile %q", card, pile)
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errConflict
+	}
+	card.Pile = pile
+	card.Position = position
+	card.DrawnAt = drawn_at
+	return nil
+}
+
+// chosenCards reads the cards of the deck's pile chosen by the options, in
+// the order they are drawn. Drawing from the top only reads the cards that
+// are drawn.
+func chosenCards(tx *gorm.DB, deck *models.Deck, pile string, options DrawOptions) ([]models.Card, error) {
+	if len(options.Codes) == 0 && (options.From == "" || options.From == FROM_TOP) {
+		cards, err := pileCards(tx, deck.Id, pile, options.Count)
+		if err != nil {
+			return nil, err
+		}
+		return cards, checkEnoughCards(len(cards), options)
+	}
+	cards, err := pileCards(tx, deck.Id, pile, -1)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := selectCards(deck, cards, options)
+	if err != nil {
+		return nil, err
+	}
+	chosen := make([]models.Card, len(selected))
+	for i, index := range selected {
+		chosen[i] = cards[index]
+	}
+	return chosen, nil
+}
+
+// discardCards moves the cards onto the top of the discard pile, one after the
+// other, and marks them drawn.
+func discardCards(tx *gorm.DB, deck_id string, cards []models.Card) error {
+	top, err := topPosition(tx, deck_id, models.DISCARD_PILE)
+	if err != nil {
+		return err
+	}
+	drawn_at := time.Now()
+	for i := 0; i < len(cards); i++ {
+		if err := moveCard(tx, &cards[i], models.DISCARD_PILE, top-i, &drawn_at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findPile reads the named pile of the deck or returns ErrPileNotFound.
+func findPile(tx *gorm.DB, deck_id string, name string) (*models.Pile, error) {
+	var pile models.Pile
+	if result := tx.First(&pile, "deck_id = ? AND name = ?", deck_id, name); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPileNotFound
+		}
+		return nil, result.Error
+	}
+	return &pile, nil
+}
+
+// addToPile moves the cards onto the top of the named pile, one after the
+// other, creating the pile when it doesn't exist yet.
+func addToPile(tx *gorm.DB, deck_id string, name string, cards []models.Card) (*models.Pile, error) {
+	pile, err := findPile(tx, deck_id, name)
+	if errors.Is(err, ErrPileNotFound) {
+		pile = &models.Pile{Id: uuid.NewString(), DeckId: deck_id, Name: name}
+		err = tx.Create(pile).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	top, err := topPosition(tx, deck_id, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(cards); i++ {
+		if err := moveCard(tx, &cards[i], name, top-i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return pile, updatePile(tx, pile, pile.Remaining+len(cards))
+}
+
+func updatePile(tx *gorm.DB, pile *models.Pile, remaining int) error {
+	result := tx.Model(&models.Pile{}).Where("id = ?", pile.Id).
+		Updates(map[string]any{"remaining": remaining, "updated_at": time.Now()})
+	if result.Error != nil {
+		log.Errorf("Failed to update pile %q of deck_id %s", pile.Name, pile.DeckId)
+		return result.Error
+	}
+	pile.Remaining = remaining
+	return nil
+}
+
+// updateDeck applies the updates to the deck and bumps its version, provided
+// nobody else bumped it since the deck was read.
+func updateDeck(tx *gorm.DB, deck *models.Deck, updates map[string]any) error {
+	updates["version"] = deck.Version + 1
+	updates["updated_at"] = time.Now()
+	result := tx.Model(&models.Deck{}).Where("id = ? AND version = ?", deck.Id, deck.Version).Updates(updates)
+	if result.Error != nil {
+		log.Error("Failed to update deck_id " + deck.Id)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errConflict
+	}
+	return nil
+}
+
+func (s *GormStore) CreateDeck(deck *models.Deck, cards []models.Card) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(deck); result.Error != nil {
+			log.Errorf("Failed to create deck %v", deck)
+			return result.Error
+		}
+		for i := 0; i < len(cards); i++ {
+			cards[i].DeckId = deck.Id
+			cards[i].Position = i
+		}
+		if len(cards) == 0 {
+			return nil
+		}
+		if result := tx.CreateInBatches(cards, 100); result.Error != nil {
+			log.Errorf("Failed to create cards for deck %v", deck)
+			return result.Error
+		}
+		return nil
+	})
+}
+
+func (s *GormStore) GetDeck(deck_id string) (*models.Deck, error) {
+	var deck models.Deck
+	if result := s.db.First(&deck, "id = ?", deck_id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrDeckNotFound
+		}
+		return nil, result.Error
+	}
+	return &deck, nil
+}
+
+func (s *GormStore) GetCards(deck_id string) ([]models.Card, error) {
+	return pileCards(s.db, deck_id, models.DECK_PILE, -1)
+}
+
+// deleteDeck deletes the deck and everything that belongs to it. With an
+// idle time the deck is only deleted when it hasn't been changed since.
+func deleteDeck(tx *gorm.DB, deck_id string, idle_since *time.Time) error {
+	query := tx.Where("id = ?", deck_id)
+	if idle_since != nil {
+		query = query.Where("updated_at < ?", *idle_since)
+	}
+	result := query.Delete(&models.Deck{})
+	if result.Error != nil {
+		log.Error("Failed to delete deck_id " + deck_id)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeckNotFound
+	}
+	for _, model := range []any{&models.Card{}, &models.Pile{}, &models.Table{}, &models.Game{}} {
+		if err := tx.Where("deck_id = ?", deck_id).Delete(model).Error; err != nil {
+			log.Error("Failed to delete deck_id " + deck_id)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GormStore) DeleteDeck(deck_id string) error {
+	return s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			return deleteDeck(tx, deck_id, nil)
+		})
+	})
+}
+
+// DeleteIdleDecks deletes the idle decks one at a time, skipping those that
+// were used since they were found.
+func (s *GormStore) DeleteIdleDecks(idle_since time.Time) (int, error) {
+	var deck_ids []string
+	if result := s.db.Model(&models.Deck{}).Where("updated_at < ?", idle_since).Pluck("id", &deck_ids); result.Error != nil {
+		return 0, result.Error
+	}
+	deleted := 0
+	for _, deck_id := range deck_ids {
+		err := s.retry(func() error {
+			return s.db.Transaction(func(tx *gorm.DB) error {
+				return deleteDeck(tx, deck_id, &idle_since)
+			})
+		})
+		if errors.Is(err, ErrDeckNotFound) {
+			continue
+		} else if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *GormStore) ListDecks(before *time.Time, limit int) ([]models.Deck, error) {
+	var decks []models.Deck
+	// decks from before shoes were marked have no table_id at all
+	query := s.db.Where("table_id IS NULL OR table_id = ?", "").Order("created_at desc").Limit(limit)
+	if before != nil {
+		query = query.Where("created_at < ?", before)
+	}
+	if result := query.Find(&decks); result.Error != nil {
+		return nil, result.Error
+	}
+	return decks, nil
+}
+
+// DrawCards moves the cards and updates the remaining count of the deck in
+// a single transaction. The deck is locked on databases that support row
+// locks, and its version is checked on update so that a concurrent draw that
+// got there first makes this one start over instead of handing out the same
+// cards twice.
+func (s *GormStore) DrawCards(deck_id string, pile string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	var deck *models.Deck
+	var cards []models.Card
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if pile != models.DISCARD_PILE {
+				if err := pileInPlay(tx, deck_id, pile); err != nil {
+					return err
+				}
+			}
+			var err error
+			deck, cards, err = drawCards(tx, deck_id, pile, options)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deck, cards, nil
+}
+
+// drawCards draws the cards onto the pile within the transaction for
+// DrawCards and DrawForPlayer.
+func drawCards(tx *gorm.DB, deck_id string, pile string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	deck, err := lockDeck(tx, deck_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	cards, err := chosenCards(tx, deck, models.DECK_PILE, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pile == models.DISCARD_PILE {
+		err = discardCards(tx, deck_id, cards)
+	} else {
+		_, err = addToPile(tx, deck_id, pile, cards)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining := deck.Remaining - len(cards)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if err := updateDeck(tx, deck, map[string]any{"remaining": remaining, "shuffles": deck.Shuffles}); err != nil {
+		return nil, nil, err
+	}
+	deck, err = lockDeck(tx, deck_id)
+	return deck, cards, err
+}
+
+// pileInPlay returns ErrPileInPlay when the named pile of the deck is the
+// hand of a game's player.
+func pileInPlay(tx *gorm.DB, deck_id string, name string) error {
+	var games []models.Game
+	if result := tx.Where("deck_id = ?", deck_id).Find(&games); result.Error != nil {
+		return result.Error
+	}
+	for _, game := range games {
+		if game.HasPlayer(name) {
+			return ErrPileInPlay
+		}
+	}
+	return nil
+}
+
+// InsertCards creates the cards and renumbers the whole deck pile around them.
+func (s *GormStore) InsertCards(deck_id string, cards []models.Card, options InsertOptions) (*models.Deck, error) {
+	var deck *models.Deck
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if deck, err = lockDeck(tx, deck_id); err != nil {
+				return err
+			}
+			pile, err := pileCards(tx, deck_id, models.DECK_PILE, -1)
+			if err != nil {
+				return err
+			}
+			inserted := make([]models.Card, len(cards))
+			for i, card := range cards {
+				card.Id = uuid.NewString()
+				card.DeckId = deck_id
+				card.Pile = models.DECK_PILE
+				card.Position = len(pile) + i
+				inserted[i] = card
+			}
+			if result := tx.Create(&inserted); result.Error != nil {
+				log.Errorf("Failed to insert cards into deck_id %s", deck_id)
+				return result.Error
+			}
+			order, err := insertCards(deck, pile, inserted, options)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < len(order); i++ {
+				if err := moveCard(tx, &order[i], models.DECK_PILE, i, nil); err != nil {
+					return err
+				}
+			}
+			if err := updateDeck(tx, deck, map[string]any{"remaining": deck.Remaining + len(cards), "shuffles": deck.Shuffles}); err != nil {
+				return err
+			}
+			deck, err = lockDeck(tx, deck_id)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deck, nil
+}
+
+func (s *GormStore) GetDiscards(deck_id string) ([]models.Card, error) {
+	return pileCards(s.db, deck_id, models.DISCARD_PILE, -1)
+}
+
+func (s *GormStore) ReturnDiscards(deck_id string, shuffle models.Shuffle) (*models.Deck, error) {
+	if shuffle != nil {
+		return s.ShuffleDeck(deck_id, true, shuffle)
+	}
+	var deck *models.Deck
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if deck, err = lockDeck(tx, deck_id); err != nil {
+				return err
+			}
+			discards, err := pileCards(tx, deck_id, models.DISCARD_PILE, -1)
+			if err != nil {
+				return err
+			}
+			bottom, err := bottomPosition(tx, deck_id, models.DECK_PILE)
+			if err != nil {
+				return err
+			}
+			// the first card drawn is at the bottom of the discard pile
+			for i := len(discards) - 1; i >= 0; i-- {
+				bottom++
+				if err := moveCard(tx, &discards[i], models.DECK_PILE, bottom, nil); err != nil {
+					return err
+				}
+			}
+			if err := updateDeck(tx, deck, map[string]any{"remaining": deck.Remaining + len(discards)}); err != nil {
+				return err
+			}
+			deck, err = lockDeck(tx, deck_id)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deck, nil
+}
+
+func (s *GormStore) ShuffleDeck(deck_id string, include_discards bool, shuffle models.Shuffle) (*models.Deck, error) {
+	var deck *models.Deck
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if deck, err = lockDeck(tx, deck_id); err != nil {
+				return err
+			}
+			cards, err := pileCards(tx, deck_id, models.DECK_PILE, -1)
+			if err != nil {
+				return err
+			}
+			remaining := deck.Remaining
+			if include_discards {
+				discards, err := pileCards(tx, deck_id, models.DISCARD_PILE, -1)
+				if err != nil {
+					return err
+				}
+				// the first card drawn is at the bottom of the discard pile
+				for i := len(discards) - 1; i >= 0; i-- {
+					cards = append(cards, discards[i])
+				}
+				remaining += len(discards)
+			}
+			shuffle(deck, cards)
+			for i := 0; i < len(cards); i++ {
+				if err := moveCard(tx, &cards[i], models.DECK_PILE, i, nil); err != nil {
+					return err
+				}
+			}
+			updates := map[string]any{"remaining": remaining, "shuffled": true, "shuffles": deck.Shuffles}
+			if err := updateDeck(tx, deck, updates); err != nil {
+				return err
+			}
+			deck, err = lockDeck(tx, deck_id)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deck, nil
+}
+
+func (s *GormStore) GetPile(deck_id string, name string) (*models.Pile, []models.Card, error) {
+	if _, err := s.GetDeck(deck_id); err != nil {
+		return nil, nil, err
+	}
+	pile, err := findPile(s.db, deck_id, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	cards, err := pileCards(s.db, deck_id, name, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pile, cards, nil
+}
+
+func (s *GormStore) DrawFromPile(deck_id string, name string, options DrawOptions) (*models.Pile, []models.Card, error) {
+	var pile *models.Pile
+	var drawn []models.Card
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			deck, err := lockDeck(tx, deck_id)
+			if err != nil {
+				return err
+			}
+			if pile, err = findPile(tx, deck_id, name); err != nil {
+				return err
+			}
+			if err := pileInPlay(tx, deck_id, name); err != nil {
+				return err
+			}
+			if drawn, err = chosenCards(tx, deck, name, options); err != nil {
+				return err
+			}
+			if err := discardCards(tx, deck_id, drawn); err != nil {
+				return err
+			}
+			if err := updatePile(tx, pile, pile.Remaining-len(drawn)); err != nil {
+				return err
+			}
+			return updateDeck(tx, deck, map[string]any{"shuffles": deck.Shuffles})
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pile, drawn, nil
+}
+
+func (s *GormStore) ShufflePile(deck_id string, name string, shuffle models.Shuffle) (*models.Pile, error) {
+	var pile *models.Pile
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			deck, err := lockDeck(tx, deck_id)
+			if err != nil {
+				return err
+			}
+			if pile, err = findPile(tx, deck_id, name); err != nil {
+				return err
+			}
+			if err := pileInPlay(tx, deck_id, name); err != nil {
+				return err
+			}
+			cards, err := pileCards(tx, deck_id, name, -1)
+			if err != nil {
+				return err
+			}
+			shuffle(deck, cards)
+			for i := 0; i < len(cards); i++ {
+				if err := moveCard(tx, &cards[i], name, i, nil); err != nil {
+					return err
+				}
+			}
+			return updateDeck(tx, deck, map[string]any{"shuffles": deck.Shuffles})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pile, nil
+}
+
+// findTable reads the table or returns ErrTableNotFound.
+func findTable(tx *gorm.DB, table_id string) (*models.Table, error) {
+	var table models.Table
+	if result := tx.First(&table, "id = ?", table_id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrTableNotFound
+		}
+		return nil, result.Error
+	}
+	return &table, nil
+}
+
+func (s *GormStore) CreateTable(table *models.Table) error {
+	if result := s.db.Create(table); result.Error != nil {
+		log.Errorf("Failed to create table %v", table)
+		return result.Error
+	}
+	return nil
+}
+
+func (s *GormStore) GetTable(table_id string) (*models.Table, error) {
+	return findTable(s.db, table_id)
+}
+
+// PlayTable plays on the table and draws from its deck in a single
+// transaction. Like the deck, the table's version is checked on update so a
+// concurrent play on the same table makes this one start over.
+// reshuffleShoe shuffles the discards of a table's shoe back into it when the
+// shoe runs out in the middle of a round. The cards on the table, which are
+// the top in_play discards, stay where they are. It returns how many cards
+// were put back.
+func reshuffleShoe(tx *gorm.DB, deck *models.Deck, in_play int) (int, error) {
+	cards, err := pileCards(tx, deck.Id, models.DECK_PILE, -1)
+	if err != nil {
+		return 0, err
+	}
+	discards, err := pileCards(tx, deck.Id, models.DISCARD_PILE, -1)
+	if err != nil {
+		return 0, err
+	}
+	if in_play > len(discards) {
+		in_play = len(discards)
+	}
+	// the first card drawn is at the bottom of the discard pile
+	for i := len(discards) - 1; i >= in_play; i-- {
+		cards = append(cards, discards[i])
+	}
+	models.ShuffleCards(deck, cards)
+	for i := 0; i < len(cards); i++ {
+		if err := moveCard(tx, &cards[i], models.DECK_PILE, i, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(discards) - in_play, nil
+}
+
+func (s *GormStore) PlayTable(table_id string, play models.Play) (*models.Table, error) {
+	var table *models.Table
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if table, err = findTable(tx, table_id); err != nil {
+				return err
+			}
+			deck, err := lockDeck(tx, table.DeckId)
+			if err != nil {
+				return err
+			}
+			drawn := 0
+			returned := 0
+			draw := func(count int) ([]models.Card, error) {
+				if deck.Remaining+returned-drawn < count {
+					put_back, err := reshuffleShoe(tx, deck, table.CardsOnTable())
+					if err != nil {
+						return nil, err
+					}
+					returned += put_back
+				}
+				cards, err := pileCards(tx, deck.Id, models.DECK_PILE, count)
+				if err != nil {
+					return nil, err
+				}
+				if err := discardCards(tx, deck.Id, cards); err != nil {
+					return nil, err
+				}
+				drawn += len(cards)
+				return cards, nil
+			}
+			if err := play(table, draw); err != nil {
+				return err
+			}
+			updates := map[string]any{"remaining": deck.Remaining + returned - drawn, "shuffles": deck.Shuffles}
+			if returned > 0 {
+				updates["shuffled"] = true
+			}
+			if err := updateDeck(tx, deck, updates); err != nil {
+				return err
+			}
+			version := table.Version
+			table.Version++
+			result := tx.Model(table).Where("version = ?", version).Select("*").Omit("created_at").Updates(table)
+			if result.Error != nil {
+				log.Error("Failed to update table " + table_id)
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errConflict
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// findGame reads the game or returns ErrGameNotFound.
+func findGame(tx *gorm.DB, game_id string) (*models.Game, error) {
+	var game models.Game
+	if result := tx.First(&game, "id = ?", game_id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrGameNotFound
+		}
+		return nil, result.Error
+	}
+	return &game, nil
+}
+
+func (s *GormStore) CreateGame(game *models.Game) error {
+	return s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			deck, err := lockDeck(tx, game.DeckId)
+			if err != nil {
+				return err
+			}
+			if deck.TableId != "" || deck.GameId != "" {
+				return ErrDeckInPlay
+			}
+			if result := tx.Create(game); result.Error != nil {
+				log.Errorf("Failed to create game %v", game)
+				return result.Error
+			}
+			return updateDeck(tx, deck, map[string]any{"game_id": game.Id})
+		})
+	})
+}
+
+func (s *GormStore) GetGame(game_id string) (*models.Game, error) {
+	return findGame(s.db, game_id)
+}
+
+func (s *GormStore) EndTurn(game_id string, player string) (*models.Game, error) {
+	var game *models.Game
+	err := s.retry(func() error {
+		var err error
+		if game, err = findGame(s.db, game_id); err != nil {
+			return err
+		}
+		if !game.HasPlayer(player) {
+			return ErrPlayerNotFound
+		}
+		if game.CurrentPlayer() != player {
+			return ErrNotYourTurn
+		}
+		version := game.Version
+		game.Turn = (game.Turn + 1) % len(game.Players)
+		game.Version++
+		result := s.db.Model(game).Where("version = ?", version).
+			Updates(map[string]any{"turn": game.Turn, "version": game.Version, "updated_at": time.Now()})
+		if result.Error != nil {
+			log.Error("Failed to update game " + game_id)
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errConflict
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// DrawForPlayer checks the turn and draws in a single transaction. The game's
+// version is bumped along with the draw, so an EndTurn that commits in the
+// meantime makes this draw start over and find it is no longer the player's
+// turn.
+func (s *GormStore) DrawForPlayer(game_id string, player string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	var deck *models.Deck
+	var cards []models.Card
+	err := s.retry(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			game, err := findGame(tx, game_id)
+			if err != nil {
+				return err
+			}
+			if !game.HasPlayer(player) {
+				return ErrPlayerNotFound
+			}
+			if game.CurrentPlayer() != player {
+				return ErrNotYourTurn
+			}
+			if deck, cards, err = drawCards(tx, game.DeckId, player, options); err != nil {
+				return err
+			}
+			result := tx.Model(game).Where("version = ?", game.Version).
+				Updates(map[string]any{"version": game.Version + 1, "updated_at": time.Now()})
+			if result.Error != nil {
+				log.Error("Failed to update game " + game_id)
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errConflict
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deck, cards, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the logic for placing the cards inserted into a pile
+
+const AT_TOP = "top"
+const AT_BOTTOM = "bottom"
+const AT_RANDOM = "random"
+
+// InsertOptions describes where cards go into a pile: At the top, the bottom
+// or random positions of the pile, or, when At is empty, Index cards down
+// from the top.
+type InsertOptions struct {
+	At    string
+	Index int
+}
+
+// insertCards returns the pile of the deck, ordered from the top down, with
+// the cards put in where the options say. Apart from random positions the
+// cards stay together in the order given, so the first card ends up highest.
+// Random positions use the deck's random number generator and are recorded on
+// the deck. An index below the bottom of the pile fails with
+// ErrInvalidPosition.
+func insertCards(deck *models.Deck, pile []models.Card, cards []models.Card, options InsertOptions) ([]models.Card, error) {
+	index := options.Index
+	switch options.At {
+	case AT_TOP:
+		index = 0
+	case AT_BOTTOM:
+		index = len(pile)
+	case AT_RANDOM:
+		random := models.DeckRand(deck)
+		inserted := append([]models.Card{}, pile...)
+		for _, card := range cards {
+			i := random.Intn(len(inserted) + 1)
+			inserted = append(inserted[:i], append([]models.Card{card}, inserted[i:]...)...)
+		}
+		return inserted, nil
+	}
+	if index < 0 || index > len(pile) {
+		return nil, fmt.Errorf("%w: %d of %d cards", ErrInvalidPosition, index, len(pile))
+	}
+	inserted := make([]models.Card, 0, len(pile)+len(cards))
+	inserted = append(inserted, pile[:index]...)
+	inserted = append(inserted, cards...)
+	return append(inserted, pile[index:]...), nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Contains the janitor that deletes the decks nobody has used for a while
+
+// How often the janitor looks for idle decks unless another interval is
+// configured
+const DEFAULT_JANITOR_INTERVAL = time.Minute
+
+// JanitorConfig sets how long a deck may stay idle before it is deleted and
+// how often the janitor looks for idle decks. A zero TTL keeps decks forever.
+type JanitorConfig struct {
+	TTL      time.Duration
+	Interval time.Duration
+}
+
+// JanitorConfigFromEnv reads the janitor configuration from the DECK_TTL and
+// JANITOR_INTERVAL environment variables, which hold durations such as 24h.
+func JanitorConfigFromEnv() (JanitorConfig, error) {
+	config := JanitorConfig{Interval: DEFAULT_JANITOR_INTERVAL}
+	if ttl := os.Getenv("DECK_TTL"); ttl != "" {
+		var err error
+		if config.TTL, err = time.ParseDuration(ttl); err != nil || config.TTL < 0 {
+			return config, errors.New("invalid DECK_TTL " + ttl)
+		}
+	}
+	if interval := os.Getenv("JANITOR_INTERVAL"); interval != "" {
+		var err error
+		if config.Interval, err = time.ParseDuration(interval); err != nil || config.Interval <= 0 {
+			return config, errors.New("invalid JANITOR_INTERVAL " + interval)
+		}
+	}
+	return config, nil
+}
+
+// Janitor deletes the decks that have been idle for longer than the TTL,
+// looking for them every interval until it is stopped.
+type Janitor struct {
+	store  DeckStore
+	config JanitorConfig
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// StartJanitor starts a janitor for the store in the background.
+func StartJanitor(deck_store DeckStore, config JanitorConfig) *Janitor {
+	janitor := &Janitor{store: deck_store, config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	go janitor.run()
+	return janitor
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case now := <-ticker.C:
+			j.Sweep(now)
+		}
+	}
+}
+
+// Sweep deletes the decks that have been idle since before now less the TTL.
+func (j *Janitor) Sweep(now time.Time) {
+	deleted, err := j.store.DeleteIdleDecks(now.Add(-j.config.TTL))
+	if err != nil {
+		log.Error("Failed to delete idle decks")
+		log.Error(err)
+	}
+	if deleted > 0 {
+		log.Infof("Deleted %d idle decks", deleted)
+	}
+}
+
+// Stop stops the janitor, waiting for a sweep in progress to finish.
+func (j *Janitor) Stop() {
+	close(j.stop)
+	<-j.done
+}
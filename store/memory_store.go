@@ -0,0 +1,582 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains a DeckStore that keeps everything in memory, mostly useful for
+// tests since nothing survives a restart
+
+type MemoryStore struct {
+	mu    sync.Mutex
+	decks map[string]models.Deck
+	// the piles of every deck, each from the top of the pile down
+	piles map[string]map[string][]models.Card
+	// the named piles of every deck
+	named_piles map[string]map[string]models.Pile
+	tables      map[string]models.Table
+	games       map[string]models.Game
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		decks:       map[string]models.Deck{},
+		piles:       map[string]map[string][]models.Card{},
+		named_piles: map[string]map[string]models.Pile{},
+		tables:      map[string]models.Table{},
+		games:       map[string]models.Game{},
+	}
+}
+
+// setPile replaces the cards of the pile, numbering them from the top down.
+func (s *MemoryStore) setPile(deck_id string, pile string, cards []models.Card) {
+	for i := 0; i < len(cards); i++ {
+		cards[i].Pile = pile
+		cards[i].Position = i
+	}
+	s.piles[deck_id][pile] = cards
+}
+
+func (s *MemoryStore) CreateDeck(deck *models.Deck, cards []models.Card) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	deck.CreatedAt = now
+	deck.UpdatedAt = now
+	for i := 0; i < len(cards); i++ {
+		cards[i].DeckId = deck.Id
+		cards[i].Pile = models.DECK_PILE
+		cards[i].Position = i
+		cards[i].CreatedAt = now
+		cards[i].UpdatedAt = now
+	}
+	s.decks[deck.Id] = *deck
+	s.piles[deck.Id] = map[string][]models.Card{}
+	s.named_piles[deck.Id] = map[string]models.Pile{}
+	s.setPile(deck.Id, models.DECK_PILE, append([]models.Card{}, cards...))
+	return nil
+}
+
+func (s *MemoryStore) GetDeck(deck_id string) (*models.Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deck, ok := s.decks[deck_id]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+	return &deck, nil
+}
+
+func (s *MemoryStore) GetCards(deck_id string) ([]models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.Card{}, s.piles[deck_id][models.DECK_PILE]...), nil
+}
+
+// deleteDeck deletes the deck and everything that belongs to it.
+func (s *MemoryStore) deleteDeck(deck_id string) {
+	delete(s.decks, deck_id)
+	delete(s.piles, deck_id)
+	delete(s.named_piles, deck_id)
+	for table_id, table := range s.tables {
+		if table.DeckId == deck_id {
+			delete(s.tables, table_id)
+		}
+	}
+	for game_id, game := range s.games {
+		if game.DeckId == deck_id {
+			delete(s.games, game_id)
+		}
+	}
+}
+
+func (s *MemoryStore) DeleteDeck(deck_id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.decks[deck_id]; !ok {
+		return ErrDeckNotFound
+	}
+	s.deleteDeck(deck_id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdleDecks(idle_since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for deck_id, deck := range s.decks {
+		if deck.UpdatedAt.Before(idle_since) {
+			s.deleteDeck(deck_id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) ListDecks(before *time.Time, limit int) ([]models.Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	decks := []models.Deck{}
+	for _, deck := range s.decks {
+		if deck.TableId == "" && (before == nil || deck.CreatedAt.Before(*before)) {
+			decks = append(decks, deck)
+		}
+	}
+	sort.Slice(decks, func(i, j int) bool {
+		return decks[i].CreatedAt.After(decks[j].CreatedAt)
+	})
+	if len(decks) > limit {
+		decks = decks[:limit]
+	}
+	return decks, nil
+}
+
+func (s *MemoryStore) DrawCards(deck_id string, pile string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.decks[deck_id]; ok && pile != models.DISCARD_PILE && s.pileInPlay(deck_id, pile) {
+		return nil, nil, ErrPileInPlay
+	}
+	return s.drawCards(deck_id, pile, options)
+}
+
+// drawCards draws the cards onto the pile for DrawCards and DrawForPlayer,
+// which hold the lock.
+func (s *MemoryStore) drawCards(deck_id string, pile string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	deck, ok := s.decks[deck_id]
+	if !ok {
+		return nil, nil, ErrDeckNotFound
+	}
+	drawn, kept, err := takeCards(&deck, s.piles[deck_id][models.DECK_PILE], options)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.setPile(deck_id, models.DECK_PILE, kept)
+	if pile == models.DISCARD_PILE {
+		s.discardCards(deck_id, drawn)
+	} else {
+		s.addToPile(deck_id, pile, drawn)
+	}
+
+	deck.Remaining -= len(drawn)
+	if deck.Remaining < 0 {
+		deck.Remaining = 0
+	}
+	s.saveDeck(deck)
+	deck = s.decks[deck_id]
+	return &deck, drawn, nil
+}
+
+func (s *MemoryStore) InsertCards(deck_id string, cards []models.Card, options InsertOptions) (*models.Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deck, ok := s.decks[deck_id]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+	now := time.Now()
+	inserted := make([]models.Card, len(cards))
+	for i, card := range cards {
+		card.Id = uuid.NewString()
+		card.DeckId = deck_id
+		card.CreatedAt = now
+		card.UpdatedAt = now
+		inserted[i] = card
+	}
+	order, err := insertCards(&deck, s.piles[deck_id][models.DECK_PILE], inserted, options)
+	if err != nil {
+		return nil, err
+	}
+	s.setPile(deck_id, models.DECK_PILE, order)
+
+	deck.Remaining += len(cards)
+	s.saveDeck(deck)
+	deck = s.decks[deck_id]
+	return &deck, nil
+}
+
+func (s *MemoryStore) GetDiscards(deck_id string) ([]models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.Card{}, s.piles[deck_id][models.DISCARD_PILE]...), nil
+}
+
+func (s *MemoryStore) ReturnDiscards(deck_id string, shuffle models.Shuffle) (*models.Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.returnDiscards(deck_id, true, shuffle)
+}
+
+func (s *MemoryStore) ShuffleDeck(deck_id string, include_discards bool, shuffle models.Shuffle) (*models.Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.returnDiscards(deck_id, include_discards, shuffle)
+}
+
+// returnDiscards puts the discards, if included, at the bottom of the deck
+// and shuffles the deck when a shuffle is given.
+func (s *MemoryStore) returnDiscards(deck_id string, include_discards bool, shuffle models.Shuffle) (*models.Deck, error) {
+	deck, ok := s.decks[deck_id]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+	cards := append([]models.Card{}, s.piles[deck_id][models.DECK_PILE]...)
+	if include_discards {
+		discards := s.piles[deck_id][models.DISCARD_PILE]
+		// the first card drawn is at the bottom of the discard pile
+		for i := len(discards) - 1; i >= 0; i-- {
+			card := discards[i]
+			card.DrawnAt = nil
+			cards = append(cards, card)
+		}
+		deck.Remaining += len(discards)
+		s.setPile(deck_id, models.DISCARD_PILE, nil)
+	}
+	if shuffle != nil {
+		shuffle(&deck, cards)
+		deck.Shuffled = true
+	}
+	s.setPile(deck_id, models.DECK_PILE, cards)
+
+	s.saveDeck(deck)
+	return &deck, nil
+}
+
+// takeCards splits the cards of the deck into those chosen by the options, in
+// the order they are drawn, and those that are kept.
+func takeCards(deck *models.Deck, cards []models.Card, options DrawOptions) ([]models.Card, []models.Card, error) {
+	selected, err := selectCards(deck, cards, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	drawn := make([]models.Card, len(selected))
+	taken := make([]bool, len(cards))
+	for i, index := range selected {
+		drawn[i] = cards[index]
+		taken[index] = true
+	}
+	kept := []models.Card{}
+	for i := 0; i < len(cards); i++ {
+		if !taken[i] {
+			kept = append(kept, cards[i])
+		}
+	}
+	return drawn, kept, nil
+}
+
+// discardCards puts the cards onto the top of the discard pile, one after the
+// other, and marks them drawn.
+func (s *MemoryStore) discardCards(deck_id string, cards []models.Card) {
+	drawn_at := time.Now()
+	discards := s.piles[deck_id][models.DISCARD_PILE]
+	for i := 0; i < len(cards); i++ {
+		cards[i].DrawnAt = &drawn_at
+		discards = append([]models.Card{cards[i]}, discards...)
+	}
+	s.setPile(deck_id, models.DISCARD_PILE, discards)
+	for i := 0; i < len(cards); i++ {
+		cards[i].Pile = models.DISCARD_PILE
+	}
+}
+
+// addToPile puts the cards onto the top of the named pile, one after the
+// other, creating the pile when it doesn't exist yet.
+func (s *MemoryStore) addToPile(deck_id string, name string, cards []models.Card) *models.Pile {
+	pile, err := s.findPile(deck_id, name)
+	if errors.Is(err, ErrPileNotFound) {
+		pile = models.Pile{Id: uuid.NewString(), DeckId: deck_id, Name: name, CreatedAt: time.Now()}
+	}
+	pile_cards := append([]models.Card{}, s.piles[deck_id][name]...)
+	for i := 0; i < len(cards); i++ {
+		cards[i].Pile = name
+		pile_cards = append([]models.Card{cards[i]}, pile_cards...)
+	}
+	return s.savePile(pile, pile_cards)
+}
+
+// savePile stores the named pile with the given cards.
+func (s *MemoryStore) savePile(pile models.Pile, cards []models.Card) *models.Pile {
+	pile.Remaining = len(cards)
+	pile.UpdatedAt = time.Now()
+	s.named_piles[pile.DeckId][pile.Name] = pile
+	s.setPile(pile.DeckId, pile.Name, cards)
+	return &pile
+}
+
+// findPile returns the named pile of the deck or an error when either of them
+// doesn't exist.
+func (s *MemoryStore) findPile(deck_id string, name string) (models.Pile, error) {
+	if _, ok := s.decks[deck_id]; !ok {
+		return models.Pile{}, ErrDeckNotFound
+	}
+	pile, ok := s.named_piles[deck_id][name]
+	if !ok {
+		return models.Pile{}, ErrPileNotFound
+	}
+	return pile, nil
+}
+
+// pileInPlay reports whether the named pile of the deck is the hand of a
+// game's player.
+func (s *MemoryStore) pileInPlay(deck_id string, name string) bool {
+	for _, game := range s.games {
+		if game.DeckId == deck_id && game.HasPlayer(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveDeck stores the modified deck, bumping its version like the GORM store.
+func (s *MemoryStore) saveDeck(deck models.Deck) {
+	deck.Version++
+	deck.UpdatedAt = time.Now()
+	s.decks[deck.Id] = deck
+}
+
+func (s *MemoryStore) GetPile(deck_id string, name string) (*models.Pile, []models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pile, err := s.findPile(deck_id, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pile, append([]models.Card{}, s.piles[deck_id][name]...), nil
+}
+
+func (s *MemoryStore) DrawFromPile(deck_id string, name string, options DrawOptions) (*models.Pile, []models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pile, err := s.findPile(deck_id, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.pileInPlay(deck_id, name) {
+		return nil, nil, ErrPileInPlay
+	}
+	deck := s.decks[deck_id]
+	drawn, kept, err := takeCards(&deck, s.piles[deck_id][name], options)
+	if err != nil {
+		return nil, nil, err
+	}
+	saved := s.savePile(pile, kept)
+	s.discardCards(deck_id, drawn)
+	s.saveDeck(deck)
+	return saved, drawn, nil
+}
+
+func (s *MemoryStore) ShufflePile(deck_id string, name string, shuffle models.Shuffle) (*models.Pile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pile, err := s.findPile(deck_id, name)
+	if err != nil {
+		return nil, err
+	}
+	if s.pileInPlay(deck_id, name) {
+		return nil, ErrPileInPlay
+	}
+	deck := s.decks[deck_id]
+	cards := append([]models.Card{}, s.piles[deck_id][name]...)
+	shuffle(&deck, cards)
+	saved := s.savePile(pile, cards)
+	s.saveDeck(deck)
+	return saved, nil
+}
+
+// copyTable copies the table along with its hands so that changes to the
+// copy don't reach the stored table.
+func copyTable(table models.Table) models.Table {
+	hands := make([]models.TableHand, len(table.Hands))
+	for i, hand := range table.Hands {
+		hand.Cards = append([]models.Card{}, hand.Cards...)
+		hands[i] = hand
+	}
+	table.Hands = hands
+	table.Dealer.Cards = append([]models.Card{}, table.Dealer.Cards...)
+	return table
+}
+
+func (s *MemoryStore) CreateTable(table *models.Table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	table.CreatedAt = now
+	table.UpdatedAt = now
+	s.tables[table.Id] = copyTable(*table)
+	return nil
+}
+
+func (s *MemoryStore) GetTable(table_id string) (*models.Table, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, ok := s.tables[table_id]
+	if !ok {
+		return nil, ErrTableNotFound
+	}
+	table = copyTable(table)
+	return &table, nil
+}
+
+// PlayTable plays on a copy of the table, dealing from the deck without
+// changing it, so that nothing is stored unless the play succeeds.
+func (s *MemoryStore) PlayTable(table_id string, play models.Play) (*models.Table, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tables[table_id]
+	if !ok {
+		return nil, ErrTableNotFound
+	}
+	deck, ok := s.decks[stored.DeckId]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+	table := copyTable(stored)
+	shoe := append([]models.Card{}, s.piles[deck.Id][models.DECK_PILE]...)
+	discards := append([]models.Card{}, s.piles[deck.Id][models.DISCARD_PILE]...)
+	drawn_at := time.Now()
+	drawn := 0
+	returned := 0
+	draw := func(count int) ([]models.Card, error) {
+		if count > len(shoe) {
+			// the shoe ran out in the middle of the round, so the discards
+			// that aren't on the table are shuffled back into it
+			in_play := table.CardsOnTable()
+			if in_play > len(discards) {
+				in_play = len(discards)
+			}
+			// the first card drawn is at the bottom of the discard pile
+			for i := len(discards) - 1; i >= in_play; i-- {
+				card := discards[i]
+				card.DrawnAt = nil
+				shoe = append(shoe, card)
+			}
+			returned += len(discards) - in_play
+			discards = discards[:in_play]
+			models.ShuffleCards(&deck, shoe)
+			deck.Shuffled = true
+		}
+		if count > len(shoe) {
+			count = len(shoe)
+		}
+		dealt := append([]models.Card{}, shoe[:count]...)
+		shoe = shoe[count:]
+		for i := 0; i < len(dealt); i++ {
+			card := dealt[i]
+			card.DrawnAt = &drawn_at
+			discards = append([]models.Card{card}, discards...)
+		}
+		drawn += count
+		return dealt, nil
+	}
+	if err := play(&table, draw); err != nil {
+		return nil, err
+	}
+
+	s.setPile(deck.Id, models.DECK_PILE, shoe)
+	s.setPile(deck.Id, models.DISCARD_PILE, discards)
+	deck.Remaining += returned - drawn
+	s.saveDeck(deck)
+
+	table.Version++
+	table.UpdatedAt = time.Now()
+	s.tables[table_id] = copyTable(table)
+	return &table, nil
+}
+
+func (s *MemoryStore) CreateGame(game *models.Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deck, ok := s.decks[game.DeckId]
+	if !ok {
+		return ErrDeckNotFound
+	}
+	if deck.TableId != "" || deck.GameId != "" {
+		return ErrDeckInPlay
+	}
+	deck.GameId = game.Id
+	s.saveDeck(deck)
+
+	now := time.Now()
+	game.CreatedAt = now
+	game.UpdatedAt = now
+	stored := *game
+	stored.Players = append([]string{}, game.Players...)
+	s.games[game.Id] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetGame(game_id string) (*models.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[game_id]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	game.Players = append([]string{}, game.Players...)
+	return &game, nil
+}
+
+func (s *MemoryStore) EndTurn(game_id string, player string) (*models.Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[game_id]
+	if !ok {
+		return nil, ErrGameNotFound
+	}
+	if !game.HasPlayer(player) {
+		return nil, ErrPlayerNotFound
+	}
+	if game.CurrentPlayer() != player {
+		return nil, ErrNotYourTurn
+	}
+	game.Turn = (game.Turn + 1) % len(game.Players)
+	game.Version++
+	game.UpdatedAt = time.Now()
+	s.games[game_id] = game
+	game.Players = append([]string{}, game.Players...)
+	return &game, nil
+}
+
+func (s *MemoryStore) DrawForPlayer(game_id string, player string, options DrawOptions) (*models.Deck, []models.Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[game_id]
+	if !ok {
+		return nil, nil, ErrGameNotFound
+	}
+	if !game.HasPlayer(player) {
+		return nil, nil, ErrPlayerNotFound
+	}
+	if game.CurrentPlayer() != player {
+		return nil, nil, ErrNotYourTurn
+	}
+	return s.drawCards(game.DeckId, player, options)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/b055/cards/models"
+)
+
+// Contains the storage interface the handlers use to manipulate decks
+
+var ErrDeckNotFound = errors.New("deck not found")
+var ErrPileNotFound = errors.New("pile not found")
+var ErrCardNotFound = errors.New("card not found")
+var ErrTableNotFound = errors.New("table not found")
+var ErrGameNotFound = errors.New("game not found")
+var ErrNoCardsLeft = errors.New("no cards left")
+var ErrNotEnoughCards = errors.New("not enough cards")
+var ErrNotYourTurn = errors.New("not the player's turn")
+var ErrPlayerNotFound = errors.New("player not found")
+var ErrPileInPlay = errors.New("pile is the hand of a player")
+var ErrDeckInPlay = errors.New("deck is already played by a table or game")
+var ErrInvalidPosition = errors.New("position is below the bottom of the deck")
+
+// DeckStore persists decks and the cards that belong to them.
+type DeckStore interface {
+	// CreateDeck stores the deck along with its cards. The first card is the
+	// top of the deck.
+	CreateDeck(deck *models.Deck, cards []models.Card) error
+	// GetDeck returns the deck with the given id or ErrDeckNotFound.
+	GetDeck(deck_id string) (*models.Deck, error)
+	// GetCards returns the cards remaining in the deck from the top down.
+	GetCards(deck_id string) ([]models.Card, error)
+	// DeleteDeck deletes the deck along with its cards, its piles and the
+	// tables and games that play with it, or returns ErrDeckNotFound.
+	DeleteDeck(deck_id string) error
+	// DeleteIdleDecks deletes, like DeleteDeck, every deck that hasn't been
+	// changed since the given time and returns how many were deleted.
+	DeleteIdleDecks(idle_since time.Time) (int, error)
+	// ListDecks returns up to limit decks, newest first, that were created
+	// before the given time. A nil time starts from the newest deck. The shoes
+	// of tables aren't listed.
+	ListDecks(before *time.Time, limit int) ([]models.Deck, error)
+	// DrawCards moves the cards chosen by the options from the deck onto the
+	// pile and returns the updated deck and the cards. Cards drawn onto the
+	// discard pile are marked drawn, other piles are created when they don't
+	// exist yet. Drawing specific cards fails with ErrCardNotFound when one
+	// of them isn't in the deck, drawing any other cards from an empty deck
+	// with ErrNoCardsLeft and a strict draw of more cards than are left with
+	// ErrNotEnoughCards. Drawing onto the hand of a game's player fails with
+	// ErrPileInPlay, those cards are drawn with GameStore.DrawForPlayer.
+	DrawCards(deck_id string, pile string, options DrawOptions) (*models.Deck, []models.Card, error)
+	// InsertCards adds new cards to the deck where the options say and
+	// returns the updated deck, or fails with ErrInvalidPosition when the
+	// index is below the bottom of the deck.
+	InsertCards(deck_id string, cards []models.Card, options InsertOptions) (*models.Deck, error)
+	// GetDiscards returns the discard pile of the deck, the most recently
+	// drawn card first.
+	GetDiscards(deck_id string) ([]models.Card, error)
+	// ReturnDiscards moves the discard pile back into the deck. Without a
+	// shuffle the discards go to the bottom of the deck in the order they
+	// were drawn, otherwise they are shuffled in with the remaining cards.
+	ReturnDiscards(deck_id string, shuffle models.Shuffle) (*models.Deck, error)
+	// ShuffleDeck shuffles the cards remaining in the deck, along with the
+	// discard pile if the discards are included, and marks it shuffled.
+	ShuffleDeck(deck_id string, include_discards bool, shuffle models.Shuffle) (*models.Deck, error)
+
+	// GetPile returns the named pile and its cards from the top down, or
+	// ErrPileNotFound.
+	GetPile(deck_id string, pile string) (*models.Pile, []models.Card, error)
+	// DrawFromPile moves the cards chosen by the options from the named pile
+	// onto the discard pile and returns them. Drawing specific cards fails
+	// with ErrCardNotFound when one of them isn't in the pile, drawing from
+	// an empty pile with ErrNoCardsLeft and a strict draw of more cards than
+	// the pile holds with ErrNotEnoughCards. The hand of a game's player only
+	// changes through the game, so drawing from it fails with ErrPileInPlay.
+	DrawFromPile(deck_id string, pile string, options DrawOptions) (*models.Pile, []models.Card, error)
+	// ShufflePile shuffles the cards of the named pile, or fails with
+	// ErrPileInPlay for the hand of a game's player.
+	ShufflePile(deck_id string, pile string, shuffle models.Shuffle) (*models.Pile, error)
+}
+
+// TableStore persists blackjack tables, which deal from a deck of the
+// DeckStore.
+type TableStore interface {
+	// CreateTable stores the table, whose deck must already exist.
+	CreateTable(table *models.Table) error
+	// GetTable returns the table with the given id or ErrTableNotFound.
+	GetTable(table_id string) (*models.Table, error)
+	// PlayTable applies the play to the table. The cards the play draws are
+	// taken from the top of the table's deck onto its discard pile. Either
+	// the whole play is stored or, when it fails, nothing is.
+	PlayTable(table_id string, play models.Play) (*models.Table, error)
+}
+
+// GameStore persists games, whose players draw from a deck of the DeckStore.
+type GameStore interface {
+	// CreateGame stores the game and marks its deck as played by it. It fails
+	// with ErrDeckNotFound when the deck doesn't exist and with ErrDeckInPlay
+	// when a table or another game already plays with it.
+	CreateGame(game *models.Game) error
+	// GetGame returns the game with the given id or ErrGameNotFound.
+	GetGame(game_id string) (*models.Game, error)
+	// EndTurn passes the turn on to the next player. It fails with
+	// ErrPlayerNotFound when the player isn't seated at the game and with
+	// ErrNotYourTurn when it isn't their turn.
+	EndTurn(game_id string, player string) (*models.Game, error)
+	// DrawForPlayer draws the cards chosen by the options from the game's
+	// deck into the player's hand, like DrawCards, and returns the updated
+	// deck and the cards. It fails with ErrPlayerNotFound when the player
+	// isn't seated at the game and with ErrNotYourTurn when it isn't their
+	// turn. The turn is checked and the cards drawn together, so the turn
+	// can't end in between.
+	DrawForPlayer(game_id string, player string, options DrawOptions) (*models.Deck, []models.Card, error)
+}
@@ -0,0 +1,853 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/b055/cards/models"
+)
+
+// newTestStores returns every DeckStore implementation so the same tests run
+// against each of them. The GORM stores get their own in-memory and file
+// backed databases.
+func newTestStores(t *testing.T) map[string]DeckStore {
+	name := strings.ReplaceAll(t.Name(), "/", "_")
+	memory_db, err := models.ConnectDatabase(models.DatabaseConfig{DSN: "file:" + name + uuid.NewString() + "?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file_db, err := models.ConnectDatabase(models.DatabaseConfig{DSN: filepath.Join(t.TempDir(), name+".db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sql_db, _ := file_db.DB()
+		sql_db.Close()
+	})
+	return map[string]DeckStore{
+		"gorm_memory": NewGormStore(memory_db),
+		"gorm_file":   NewGormStore(file_db),
+		"memory":      NewMemoryStore(),
+	}
+}
+
+// fullDeckCodes returns the codes of a standard 52 card deck.
+func fullDeckCodes() []string {
+	var codes []string
+	for _, suit := range []string{"S", "C", "H", "D"} {
+		for _, value := range []string{"A", "2", "3", "4", "5", "6", "7", "8", "9", "10", "J", "Q", "K"} {
+			codes = append(codes, value+suit)
+		}
+	}
+	return codes
+}
+
+func newTestDeck(t *testing.T, deck_store DeckStore, codes ...string) *models.Deck {
+	var cards []models.Card
+	for _, code := range codes {
+		suit, value, err := models.CodeToSuitValue(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cards = append(cards, models.Card{Id: uuid.NewString(), Suit: *suit, Value: *value})
+	}
+	deck := models.Deck{Id: uuid.NewString(), Remaining: len(cards)}
+	if err := deck_store.CreateDeck(&deck, cards); err != nil {
+		t.Fatal(err)
+	}
+	return &deck
+}
+
+func Test_CreateDeck_GetDeck(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C")
+
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 3, stored.Remaining, name)
+
+		cards, err := deck_store.GetCards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Len(t, cards, 3, name)
+	}
+}
+
+func Test_CreateDeck_Commitment(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		cards := []models.Card{{Id: uuid.NewString(), Suit: models.Spades, Value: models.Ace}, {Id: uuid.NewString(), Suit: models.Hearts, Value: models.King}}
+		deck := models.Deck{Id: uuid.NewString(), Remaining: len(cards), ShuffleMode: models.SECURE_SHUFFLE}
+		assert.NoError(t, deck.CommitOrder(cards), name)
+		assert.NoError(t, deck_store.CreateDeck(&deck, cards), name)
+
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, models.SECURE_SHUFFLE, stored.ShuffleMode, name)
+		assert.Equal(t, deck.Commitment, stored.Commitment, name)
+		assert.Equal(t, deck.Salt, stored.Salt, name)
+		assert.Equal(t, "AS,KH", stored.InitialOrder, name)
+	}
+}
+
+func Test_GetDeck_NotFound(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		_, err := deck_store.GetDeck("missing")
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+
+		_, _, err = deck_store.DrawCards("missing", models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+	}
+}
+
+func Test_ListDecks(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		for i := 0; i < 3; i++ {
+			newTestDeck(t, deck_store, "AS")
+		}
+		decks, err := deck_store.ListDecks(nil, 2)
+		assert.NoError(t, err, name)
+		assert.Len(t, decks, 2, name)
+		assert.False(t, decks[0].CreatedAt.Before(decks[1].CreatedAt), name)
+
+		decks, err = deck_store.ListDecks(&decks[1].CreatedAt, 2)
+		assert.NoError(t, err, name)
+		assert.Len(t, decks, 1, name)
+
+		// decks migrated from before shoes were marked are still listed
+		if gorm_store, ok := deck_store.(*GormStore); ok {
+			assert.NoError(t, gorm_store.db.Exec("UPDATE decks SET table_id = NULL").Error, name)
+			decks, err = deck_store.ListDecks(nil, 5)
+			assert.NoError(t, err, name)
+			assert.Len(t, decks, 3, name)
+		}
+	}
+}
+
+func Test_DrawCards(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C")
+
+		_, cards, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.Len(t, cards, 2, name)
+
+		_, cards, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.Len(t, cards, 1, name)
+
+		stored, _ := deck_store.GetDeck(deck.Id)
+		assert.EqualValues(t, 0, stored.Remaining, name)
+		remaining, _ := deck_store.GetCards(deck.Id)
+		assert.Empty(t, remaining, name)
+
+		_, _, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrNoCardsLeft, name)
+		_, _, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 1, From: FROM_BOTTOM})
+		assert.ErrorIs(t, err, ErrNoCardsLeft, name)
+	}
+}
+
+// Test_DrawCards_Concurrent hammers a single deck from many goroutines and
+// checks every card is handed out exactly once.
+func Test_DrawCards_Concurrent(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, fullDeckCodes()...)
+
+		var mu sync.Mutex
+		drawn := map[string]int{}
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(count int) {
+				defer wg.Done()
+				for {
+					_, cards, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: count})
+					if errors.Is(err, ErrNoCardsLeft) {
+						return
+					} else if err != nil {
+						t.Error(name, err)
+						return
+					}
+					mu.Lock()
+					for _, card := range cards {
+						drawn[card.Id]++
+					}
+					mu.Unlock()
+				}
+			}(i%3 + 1)
+		}
+		wg.Wait()
+
+		assert.Len(t, drawn, 52, name)
+		for id, times := range drawn {
+			assert.EqualValues(t, 1, times, name+" card "+id)
+		}
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 0, stored.Remaining, name)
+	}
+}
+
+func codes(cards []models.Card) []string {
+	var result []string
+	for _, card := range cards {
+		card.ComputeCode()
+		result = append(result, card.Code)
+	}
+	return result
+}
+
+func Test_DrawCards_FromTop(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH", "2D")
+
+		_, cards, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"8C", "AS"}, codes(cards), name)
+
+		cards, err = deck_store.GetCards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"KH", "2D"}, codes(cards), name)
+	}
+}
+
+func Test_Discards(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH", "2D")
+
+		_, _, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		_, _, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+
+		discards, err := deck_store.GetDiscards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"KH", "AS", "8C"}, codes(discards), name)
+		for _, card := range discards {
+			assert.NotNil(t, card.DrawnAt, name)
+		}
+
+		returned, err := deck_store.ReturnDiscards(deck.Id, nil)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 4, returned.Remaining, name)
+		assert.False(t, returned.Shuffled, name)
+		cards, _ := deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"2D", "8C", "AS", "KH"}, codes(cards), name)
+		for _, card := range cards {
+			assert.Nil(t, card.DrawnAt, name)
+		}
+		discards, _ = deck_store.GetDiscards(deck.Id)
+		assert.Empty(t, discards, name)
+	}
+}
+
+// reverse is a predictable stand in for a shuffle.
+func reverse(deck *models.Deck, cards []models.Card) {
+	for i, j := 0, len(cards)-1; i < j; i, j = i+1, j-1 {
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+}
+
+func Test_ReturnDiscards_Shuffled(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH", "2D")
+		_, _, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+
+		returned, err := deck_store.ReturnDiscards(deck.Id, reverse)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 4, returned.Remaining, name)
+		assert.True(t, returned.Shuffled, name)
+		cards, _ := deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"AS", "8C", "2D", "KH"}, codes(cards), name)
+	}
+}
+
+func Test_ShuffleDeck(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH", "2D")
+		_, _, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+
+		shuffled, err := deck_store.ShuffleDeck(deck.Id, false, reverse)
+		assert.NoError(t, err, name)
+		assert.True(t, shuffled.Shuffled, name)
+		assert.EqualValues(t, 3, shuffled.Remaining, name)
+		cards, _ := deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"2D", "KH", "AS"}, codes(cards), name)
+		discards, _ := deck_store.GetDiscards(deck.Id)
+		assert.Equal(t, []string{"8C"}, codes(discards), name)
+
+		shuffled, err = deck_store.ShuffleDeck(deck.Id, true, reverse)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 4, shuffled.Remaining, name)
+		cards, _ = deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"8C", "AS", "KH", "2D"}, codes(cards), name)
+		discards, _ = deck_store.GetDiscards(deck.Id)
+		assert.Empty(t, discards, name)
+
+		_, err = deck_store.ShuffleDeck("missing", true, reverse)
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+	}
+}
+
+func Test_Piles(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH", "2D", "3S", "4H")
+
+		_, _, err := deck_store.GetPile(deck.Id, "alice")
+		assert.ErrorIs(t, err, ErrPileNotFound, name)
+
+		updated, _, err := deck_store.DrawCards(deck.Id, "alice", DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 4, updated.Remaining, name)
+		_, _, err = deck_store.DrawCards(deck.Id, "alice", DrawOptions{Count: 3})
+		assert.NoError(t, err, name)
+
+		pile, cards, err := deck_store.GetPile(deck.Id, "alice")
+		assert.NoError(t, err, name)
+		assert.Equal(t, "alice", pile.Name, name)
+		assert.EqualValues(t, 5, pile.Remaining, name)
+		assert.Equal(t, []string{"3S", "2D", "KH", "AS", "8C"}, codes(cards), name)
+
+		pile, drawn, err := deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Count: 1, From: FROM_TOP})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"3S"}, codes(drawn), name)
+		assert.EqualValues(t, 4, pile.Remaining, name)
+
+		_, drawn, err = deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Count: 2, From: FROM_BOTTOM})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"8C", "AS"}, codes(drawn), name)
+
+		_, _, err = deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Codes: []string{"KH", "4H"}})
+		assert.ErrorIs(t, err, ErrCardNotFound, name)
+		pile, drawn, err = deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Codes: []string{"KH"}})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"KH"}, codes(drawn), name)
+		assert.EqualValues(t, 1, pile.Remaining, name)
+
+		_, drawn, err = deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Count: 5, From: FROM_RANDOM})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"2D"}, codes(drawn), name)
+
+		discards, _ := deck_store.GetDiscards(deck.Id)
+		assert.Len(t, discards, 5, name)
+		remaining, _ := deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"4H"}, codes(remaining), name)
+	}
+}
+
+func Test_ShufflePile(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "8C", "AS", "KH")
+		_, _, err := deck_store.DrawCards(deck.Id, "bob", DrawOptions{Count: 3})
+		assert.NoError(t, err, name)
+
+		pile, err := deck_store.ShufflePile(deck.Id, "bob", reverse)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 3, pile.Remaining, name)
+		_, cards, _ := deck_store.GetPile(deck.Id, "bob")
+		assert.Equal(t, []string{"8C", "AS", "KH"}, codes(cards), name)
+
+		_, err = deck_store.ShufflePile(deck.Id, "carol", reverse)
+		assert.ErrorIs(t, err, ErrPileNotFound, name)
+		_, err = deck_store.ShufflePile("missing", "bob", reverse)
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+	}
+}
+
+// Test_ShuffleDeck_Seeded checks every store replays the shuffles of a seeded
+// deck in the same order.
+func Test_ShuffleDeck_Seeded(t *testing.T) {
+	var orders [][]string
+	for name, deck_store := range newTestStores(t) {
+		seed := int64(7)
+		deck := models.Deck{Id: uuid.NewString(), Remaining: 52, Seed: &seed}
+		var cards []models.Card
+		for _, code := range fullDeckCodes() {
+			suit, value, _ := models.CodeToSuitValue(code)
+			cards = append(cards, models.Card{Id: uuid.NewString(), Suit: *suit, Value: *value})
+		}
+		assert.NoError(t, deck_store.CreateDeck(&deck, cards), name)
+
+		_, err := deck_store.ShuffleDeck(deck.Id, false, models.ShuffleCards)
+		assert.NoError(t, err, name)
+		first, _ := deck_store.GetCards(deck.Id)
+		shuffled, err := deck_store.ShuffleDeck(deck.Id, false, models.ShuffleCards)
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 2, shuffled.Shuffles, name)
+		second, _ := deck_store.GetCards(deck.Id)
+		assert.NotEqual(t, codes(first), codes(second), name)
+
+		orders = append(orders, append(codes(first), codes(second)...))
+	}
+	for i := 1; i < len(orders); i++ {
+		assert.Equal(t, orders[0], orders[i])
+	}
+}
+
+// Test_DrawCards_RandomSeeded checks random draws from a seeded deck come
+// from the deck's own generator, the same way in every store, and are
+// counted like shuffles.
+func Test_DrawCards_RandomSeeded(t *testing.T) {
+	var draws [][]string
+	for name, deck_store := range newTestStores(t) {
+		seed := int64(7)
+		deck := models.Deck{Id: uuid.NewString(), Remaining: 52, Seed: &seed}
+		var cards []models.Card
+		for _, code := range fullDeckCodes() {
+			suit, value, _ := models.CodeToSuitValue(code)
+			cards = append(cards, models.Card{Id: uuid.NewString(), Suit: *suit, Value: *value})
+		}
+		assert.NoError(t, deck_store.CreateDeck(&deck, cards), name)
+
+		drawn_deck, first, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 5, From: FROM_RANDOM})
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 1, drawn_deck.Shuffles, name)
+		drawn_deck, second, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 5, From: FROM_RANDOM})
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 2, drawn_deck.Shuffles, name)
+		drawn_deck, _, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 2, drawn_deck.Shuffles, name)
+
+		draws = append(draws, append(codes(first), codes(second)...))
+	}
+	for i := 1; i < len(draws); i++ {
+		assert.Equal(t, draws[0], draws[i])
+	}
+}
+
+func Test_PlayTable(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		table_store := deck_store.(TableStore)
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C", "2D", "QS")
+		table := models.Table{Id: uuid.NewString(), DeckId: deck.Id, Seats: 1, Status: models.TABLE_WAITING}
+		assert.NoError(t, table_store.CreateTable(&table), name)
+
+		_, err := table_store.GetTable("missing")
+		assert.ErrorIs(t, err, ErrTableNotFound, name)
+		_, err = table_store.PlayTable("missing", nil)
+		assert.ErrorIs(t, err, ErrTableNotFound, name)
+
+		// the play draws from the top of the deck onto the discard pile
+		deal := func(table *models.Table, draw models.Draw) error {
+			cards, err := draw(2)
+			if err != nil {
+				return err
+			}
+			table.Hands = []models.TableHand{{Seat: 1, Bet: 10, Cards: cards}}
+			table.Status = models.TABLE_PLAYING
+			return nil
+		}
+		played, err := table_store.PlayTable(table.Id, deal)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"AS", "KH"}, codes(played.Hands[0].Cards), name)
+
+		stored, err := table_store.GetTable(table.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, models.TABLE_PLAYING, stored.Status, name)
+		assert.Equal(t, 10, stored.Hands[0].Bet, name)
+		assert.Equal(t, []string{"AS", "KH"}, codes(stored.Hands[0].Cards), name)
+		updated, _ := deck_store.GetDeck(deck.Id)
+		assert.EqualValues(t, 3, updated.Remaining, name)
+		discards, _ := deck_store.GetDiscards(deck.Id)
+		assert.Len(t, discards, 2, name)
+
+		// a failed play changes nothing
+		failed := errors.New("failed")
+		_, err = table_store.PlayTable(table.Id, func(table *models.Table, draw models.Draw) error {
+			if _, err := draw(2); err != nil {
+				return err
+			}
+			table.Status = models.TABLE_FINISHED
+			return failed
+		})
+		assert.ErrorIs(t, err, failed, name)
+		stored, _ = table_store.GetTable(table.Id)
+		assert.Equal(t, models.TABLE_PLAYING, stored.Status, name)
+		updated, _ = deck_store.GetDeck(deck.Id)
+		assert.EqualValues(t, 3, updated.Remaining, name)
+		remaining, _ := deck_store.GetCards(deck.Id)
+		assert.Equal(t, []string{"8C", "2D", "QS"}, codes(remaining), name)
+	}
+}
+
+// Test_PlayTable_Reshuffle runs the shoe out in the middle of a round and
+// checks the discards that aren't on the table are shuffled back into it.
+func Test_PlayTable_Reshuffle(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		table_store := deck_store.(TableStore)
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C", "2D", "QS")
+		table := models.Table{Id: uuid.NewString(), DeckId: deck.Id, Seats: 1, Status: models.TABLE_WAITING}
+		assert.NoError(t, table_store.CreateTable(&table), name)
+
+		// each round clears the table and deals the hand one card at a time
+		deal := func(count int) models.Play {
+			return func(table *models.Table, draw models.Draw) error {
+				table.Hands = []models.TableHand{{Seat: 1}}
+				for i := 0; i < count; i++ {
+					cards, err := draw(1)
+					if err != nil {
+						return err
+					}
+					if len(cards) == 0 {
+						return errors.New("shoe is empty")
+					}
+					table.Hands[0].Cards = append(table.Hands[0].Cards, cards...)
+				}
+				return nil
+			}
+		}
+		_, err := table_store.PlayTable(table.Id, deal(3))
+		assert.NoError(t, err, name)
+		played, err := table_store.PlayTable(table.Id, deal(4))
+		assert.NoError(t, err, name)
+		hand := codes(played.Hands[0].Cards)
+		assert.Len(t, hand, 4, name)
+		assert.Equal(t, []string{"2D", "QS"}, hand[:2], name)
+		remaining, _ := deck_store.GetCards(deck.Id)
+		assert.ElementsMatch(t, []string{"AS", "KH", "8C", "2D", "QS"}, append(codes(remaining), hand...), name)
+
+		updated, _ := deck_store.GetDeck(deck.Id)
+		assert.EqualValues(t, 1, updated.Remaining, name)
+		assert.True(t, updated.Shuffled, name)
+		discards, _ := deck_store.GetDiscards(deck.Id)
+		assert.ElementsMatch(t, hand, codes(discards), name)
+
+		// a round needing more cards than are off the table comes up short
+		_, err = table_store.PlayTable(table.Id, deal(6))
+		assert.Error(t, err, name)
+	}
+}
+
+// Test_PlayTable_Concurrent plays on the same table from many goroutines and
+// checks no play was lost and no card dealt twice.
+func Test_PlayTable_Concurrent(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		table_store := deck_store.(TableStore)
+		deck := newTestDeck(t, deck_store, fullDeckCodes()...)
+		table := models.Table{Id: uuid.NewString(), DeckId: deck.Id, Seats: 1, Hands: []models.TableHand{{Seat: 1}}}
+		assert.NoError(t, table_store.CreateTable(&table), name)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := table_store.PlayTable(table.Id, func(table *models.Table, draw models.Draw) error {
+					cards, err := draw(1)
+					table.Hands[0].Cards = append(table.Hands[0].Cards, cards...)
+					return err
+				})
+				assert.NoError(t, err, name)
+			}()
+		}
+		wg.Wait()
+
+		stored, _ := table_store.GetTable(table.Id)
+		dealt := codes(stored.Hands[0].Cards)
+		assert.Len(t, dealt, 16, name)
+		assert.Equal(t, fullDeckCodes()[:16], dealt, name)
+	}
+}
+
+func Test_DrawCards_ToPile(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C", "2D")
+
+		_, cards, err := deck_store.DrawCards(deck.Id, "alice", DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"AS", "KH"}, codes(cards), name)
+		_, cards, err = deck_store.DrawCards(deck.Id, "alice", DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"8C"}, codes(cards), name)
+
+		// the cards go onto the pile rather than the discard pile
+		pile, pile_cards, err := deck_store.GetPile(deck.Id, "alice")
+		assert.NoError(t, err, name)
+		assert.Equal(t, 3, pile.Remaining, name)
+		assert.Equal(t, []string{"8C", "KH", "AS"}, codes(pile_cards), name)
+		discards, err := deck_store.GetDiscards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Empty(t, discards, name)
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, 1, stored.Remaining, name)
+	}
+}
+
+func Test_EndTurn(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		game_store := deck_store.(GameStore)
+		deck := newTestDeck(t, deck_store, "AS", "KH")
+		game := models.Game{Id: uuid.NewString(), DeckId: deck.Id, Players: []string{"alice", "bob"}}
+		assert.NoError(t, game_store.CreateGame(&game), name)
+
+		_, err := game_store.GetGame("missing")
+		assert.ErrorIs(t, err, ErrGameNotFound, name)
+		_, err = game_store.EndTurn(game.Id, "bob")
+		assert.ErrorIs(t, err, ErrNotYourTurn, name)
+		_, err = game_store.EndTurn(game.Id, "carol")
+		assert.ErrorIs(t, err, ErrPlayerNotFound, name)
+
+		ended, err := game_store.EndTurn(game.Id, "alice")
+		assert.NoError(t, err, name)
+		assert.Equal(t, "bob", ended.CurrentPlayer(), name)
+		ended, err = game_store.EndTurn(game.Id, "bob")
+		assert.NoError(t, err, name)
+		assert.Equal(t, "alice", ended.CurrentPlayer(), name)
+
+		stored, err := game_store.GetGame(game.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"alice", "bob"}, stored.Players, name)
+		assert.Equal(t, 0, stored.Turn, name)
+	}
+}
+
+func Test_CreateGame(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		game_store := deck_store.(GameStore)
+		deck := newTestDeck(t, deck_store, "AS", "KH")
+		game := models.Game{Id: uuid.NewString(), DeckId: deck.Id, Players: []string{"alice"}}
+		assert.NoError(t, game_store.CreateGame(&game), name)
+		played, _ := deck_store.GetDeck(deck.Id)
+		assert.Equal(t, game.Id, played.GameId, name)
+
+		// a deck is only played by one game at a time
+		other := models.Game{Id: uuid.NewString(), DeckId: deck.Id, Players: []string{"bob"}}
+		assert.ErrorIs(t, game_store.CreateGame(&other), ErrDeckInPlay, name)
+		_, err := game_store.GetGame(other.Id)
+		assert.ErrorIs(t, err, ErrGameNotFound, name)
+		other.DeckId = "missing"
+		assert.ErrorIs(t, game_store.CreateGame(&other), ErrDeckNotFound, name)
+	}
+}
+
+func Test_DrawForPlayer(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		game_store := deck_store.(GameStore)
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C", "2D")
+		game := models.Game{Id: uuid.NewString(), DeckId: deck.Id, Players: []string{"alice", "bob"}}
+		assert.NoError(t, game_store.CreateGame(&game), name)
+
+		_, _, err := game_store.DrawForPlayer("missing", "alice", DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrGameNotFound, name)
+		_, _, err = game_store.DrawForPlayer(game.Id, "carol", DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrPlayerNotFound, name)
+		_, _, err = game_store.DrawForPlayer(game.Id, "bob", DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrNotYourTurn, name)
+		drawn_deck, cards, err := game_store.DrawForPlayer(game.Id, "alice", DrawOptions{Count: 2})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"AS", "KH"}, codes(cards), name)
+		assert.Equal(t, 2, drawn_deck.Remaining, name)
+
+		// the hands only change through the game
+		_, _, err = deck_store.DrawCards(deck.Id, "bob", DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrPileInPlay, name)
+		_, _, err = deck_store.DrawFromPile(deck.Id, "alice", DrawOptions{Count: 1})
+		assert.ErrorIs(t, err, ErrPileInPlay, name)
+		_, err = deck_store.ShufflePile(deck.Id, "alice", models.ShuffleCards)
+		assert.ErrorIs(t, err, ErrPileInPlay, name)
+		_, _, err = deck_store.DrawCards(deck.Id, "carol", DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+
+		pile, _, err := deck_store.GetPile(deck.Id, "alice")
+		assert.NoError(t, err, name)
+		assert.Equal(t, 2, pile.Remaining, name)
+		_, _, err = deck_store.GetPile(deck.Id, "bob")
+		assert.ErrorIs(t, err, ErrPileNotFound, name)
+	}
+}
+
+func Test_DrawCards_Options(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C", "2D", "QS", "7H")
+
+		_, cards, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2, From: FROM_BOTTOM})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"7H", "QS"}, codes(cards), name)
+		_, cards, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Codes: []string{"8C", "AS"}})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"8C", "AS"}, codes(cards), name)
+
+		// a missing card draws nothing at all
+		_, _, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Codes: []string{"KH", "QS"}})
+		assert.ErrorIs(t, err, ErrCardNotFound, name)
+		remaining, err := deck_store.GetCards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"KH", "2D"}, codes(remaining), name)
+
+		_, cards, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 5, From: FROM_RANDOM})
+		assert.NoError(t, err, name)
+		assert.ElementsMatch(t, []string{"KH", "2D"}, codes(cards), name)
+
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, 0, stored.Remaining, name)
+		discards, err := deck_store.GetDiscards(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Len(t, discards, 6, name)
+	}
+}
+
+func Test_DrawCards_Strict(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C")
+
+		// a strict draw of more cards than are left draws nothing at all
+		for _, from := range []string{FROM_TOP, FROM_BOTTOM, FROM_RANDOM} {
+			_, _, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 4, From: from, Mode: DRAW_STRICT})
+			assert.ErrorIs(t, err, ErrNotEnoughCards, name+" "+from)
+		}
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, 3, stored.Remaining, name)
+
+		drawn_from, cards, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2, From: FROM_TOP, Mode: DRAW_STRICT})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"AS", "KH"}, codes(cards), name)
+		assert.Equal(t, 1, drawn_from.Remaining, name)
+
+		drawn_from, cards, err = deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Count: 2, From: FROM_TOP, Mode: DRAW_PARTIAL})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"8C"}, codes(cards), name)
+		assert.Equal(t, 0, drawn_from.Remaining, name)
+	}
+}
+
+func Test_InsertCards(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C")
+		_, err := deck_store.InsertCards("missing", []models.Card{models.NewCard(models.Spades, models.Two)}, InsertOptions{At: AT_TOP})
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+
+		inserted, err := deck_store.InsertCards(deck.Id, []models.Card{models.NewCard(models.Diamonds, models.Two), models.NewCard(models.Clubs, models.Three)}, InsertOptions{At: AT_TOP})
+		assert.NoError(t, err, name)
+		assert.Equal(t, 5, inserted.Remaining, name)
+		_, err = deck_store.InsertCards(deck.Id, []models.Card{models.NewCard(models.Hearts, models.Queen)}, InsertOptions{At: AT_BOTTOM})
+		assert.NoError(t, err, name)
+		_, err = deck_store.InsertCards(deck.Id, []models.Card{models.NewCard(models.Spades, models.Nine)}, InsertOptions{Index: 3})
+		assert.NoError(t, err, name)
+		_, err = deck_store.InsertCards(deck.Id, []models.Card{models.NewCard(models.Spades, models.Five)}, InsertOptions{Index: 8})
+		assert.ErrorIs(t, err, ErrInvalidPosition, name)
+		inserted, err = deck_store.InsertCards(deck.Id, []models.Card{models.NewCard(models.Spades, models.Four)}, InsertOptions{At: AT_RANDOM})
+		assert.NoError(t, err, name)
+		assert.EqualValues(t, 1, inserted.Shuffles, name)
+
+		cards, err := deck_store.GetCards(deck.Id)
+		assert.NoError(t, err, name)
+		var fixed []string
+		for _, code := range codes(cards) {
+			if code != "4S" {
+				fixed = append(fixed, code)
+			}
+		}
+		assert.Equal(t, []string{"2D", "3C", "AS", "9S", "KH", "8C", "QH"}, fixed, name)
+		assert.Len(t, cards, 8, name)
+
+		// the inserted cards are drawn like any other
+		_, drawn, err := deck_store.DrawCards(deck.Id, models.DISCARD_PILE, DrawOptions{Codes: []string{"QH"}})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"QH"}, codes(drawn), name)
+		stored, err := deck_store.GetDeck(deck.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, 7, stored.Remaining, name)
+	}
+}
+
+func Test_DeleteDeck(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		deck := newTestDeck(t, deck_store, "AS", "KH", "8C")
+		_, _, err := deck_store.DrawCards(deck.Id, "alice", DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+		table := models.Table{Id: uuid.NewString(), DeckId: deck.Id, Seats: 1, Status: models.TABLE_WAITING}
+		assert.NoError(t, deck_store.(TableStore).CreateTable(&table), name)
+		game := models.Game{Id: uuid.NewString(), DeckId: deck.Id, Players: []string{"alice"}}
+		assert.NoError(t, deck_store.(GameStore).CreateGame(&game), name)
+		other := newTestDeck(t, deck_store, "2D")
+
+		assert.NoError(t, deck_store.DeleteDeck(deck.Id), name)
+		assert.ErrorIs(t, deck_store.DeleteDeck(deck.Id), ErrDeckNotFound, name)
+		_, err = deck_store.GetDeck(deck.Id)
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+		_, _, err = deck_store.GetPile(deck.Id, "alice")
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+		_, err = deck_store.(TableStore).GetTable(table.Id)
+		assert.ErrorIs(t, err, ErrTableNotFound, name)
+		_, err = deck_store.(GameStore).GetGame(game.Id)
+		assert.ErrorIs(t, err, ErrGameNotFound, name)
+
+		// the other decks are left alone
+		cards, err := deck_store.GetCards(other.Id)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"2D"}, codes(cards), name)
+		if gorm_store, ok := deck_store.(*GormStore); ok {
+			var count int64
+			gorm_store.db.Model(&models.Card{}).Where("deck_id = ?", deck.Id).Count(&count)
+			assert.Zero(t, count, name)
+		}
+	}
+}
+
+func Test_DeleteIdleDecks(t *testing.T) {
+	for name, deck_store := range newTestStores(t) {
+		idle := newTestDeck(t, deck_store, "AS")
+		used := newTestDeck(t, deck_store, "KH", "8C")
+		since := time.Now()
+		_, _, err := deck_store.DrawCards(used.Id, models.DISCARD_PILE, DrawOptions{Count: 1})
+		assert.NoError(t, err, name)
+
+		deleted, err := deck_store.DeleteIdleDecks(since)
+		assert.NoError(t, err, name)
+		assert.Equal(t, 1, deleted, name)
+		_, err = deck_store.GetDeck(idle.Id)
+		assert.ErrorIs(t, err, ErrDeckNotFound, name)
+		_, err = deck_store.GetDeck(used.Id)
+		assert.NoError(t, err, name)
+	}
+}
+
+func Test_Janitor(t *testing.T) {
+	deck_store := NewMemoryStore()
+	deck := newTestDeck(t, deck_store, "AS")
+	janitor := StartJanitor(deck_store, JanitorConfig{TTL: time.Hour, Interval: time.Millisecond})
+
+	janitor.Sweep(time.Now())
+	_, err := deck_store.GetDeck(deck.Id)
+	assert.NoError(t, err)
+	janitor.Sweep(time.Now().Add(2 * time.Hour))
+	_, err = deck_store.GetDeck(deck.Id)
+	assert.ErrorIs(t, err, ErrDeckNotFound)
+
+	// stopping waits for the janitor to finish
+	janitor.Stop()
+}
+
+func Test_JanitorConfigFromEnv(t *testing.T) {
+	t.Setenv("DECK_TTL", "")
+	t.Setenv("JANITOR_INTERVAL", "")
+	config, err := JanitorConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, JanitorConfig{Interval: DEFAULT_JANITOR_INTERVAL}, config)
+
+	t.Setenv("DECK_TTL", "24h")
+	t.Setenv("JANITOR_INTERVAL", "5m")
+	config, err = JanitorConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, JanitorConfig{TTL: 24 * time.Hour, Interval: 5 * time.Minute}, config)
+
+	t.Setenv("DECK_TTL", "forever")
+	_, err = JanitorConfigFromEnv()
+	assert.Error(t, err)
+	t.Setenv("DECK_TTL", "")
+	t.Setenv("JANITOR_INTERVAL", "0s")
+	_, err = JanitorConfigFromEnv()
+	assert.Error(t, err)
+}